@@ -6,7 +6,7 @@ import (
 	"github.com/lwes/lwes-go"
 )
 
-func BenchmarkLwesEncode(b *testing.B) {
+func newPerfMsg() *lwes.LwesEvent {
 	lwe := lwes.NewLwesEvent("MonDemand::PerfMsg")
 	lwe.Set("id", "0db302ef-4ba1-4d6b-86e3-92793d4b0c9e")
 	lwe.Set("caller_label", "broker")
@@ -21,6 +21,11 @@ func BenchmarkLwesEncode(b *testing.B) {
 	lwe.Set("label0", "adunit:538494050:call:1:ssrtb")
 	lwe.Set("start0", int64(1494880081332))
 	lwe.Set("end0", int64(1494880081487))
+	return lwe
+}
+
+func BenchmarkLwesEncode(b *testing.B) {
+	lwe := newPerfMsg()
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -31,3 +36,26 @@ func BenchmarkLwesEncode(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkLwesDecode(b *testing.B) {
+	bs, _ := lwes.Marshal(newPerfMsg())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var lwe lwes.LwesEvent
+		if err := lwes.Unmarshal(bs, &lwe); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPeekName(b *testing.B) {
+	bs, _ := lwes.Marshal(newPerfMsg())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if name, err := lwes.PeekName(bs); err != nil || name != "MonDemand::PerfMsg" {
+			b.Fatalf("got name %q, err %v", name, err)
+		}
+	}
+}
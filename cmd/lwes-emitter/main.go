@@ -0,0 +1,137 @@
+// Command lwes-emitter emits the events of a text like the output of the
+// event printers, from the command line, files or stdin, optionally many
+// times at a rate.
+//
+//	lwes-emitter -emit lwes::239.5.1.100:11311 -count 100 -rate 10 \
+//		-event 'MonDemand::StatsMsg { string prog_id = "test"; uint16 num = 1; string k0 = "x"; int64 v0 = 5; }'
+//
+// See lwes.ParseText for the syntax.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+)
+
+var (
+	emits  cli.ArrayFlags
+	texts  cli.ArrayFlags
+	count  int
+	rate   float64
+	dryRun bool
+)
+
+func init() {
+	flag.Var(&emits, "emit", cli.EmitUsage)
+	flag.Var(&texts, "event", "the text of the events to emit; repeatable (default the files of the args, or stdin)")
+	flag.IntVar(&count, "count", 1, "emit the events this many times; 0 until interrupted")
+	flag.Float64Var(&rate, "rate", 0, "emit this many events per second; 0 for as fast as possible")
+	flag.BoolVar(&dryRun, "n", false, "print the events parsed instead of emitting them")
+}
+
+// readEvents parses the events of the -event flags, then of the files,
+// "-" being stdin
+func readEvents(texts, files []string) ([]*lwes.LwesEvent, error) {
+	var events []*lwes.LwesEvent
+	for _, text := range texts {
+		parsed, err := lwes.ParseText(text)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, parsed...)
+	}
+
+	for _, file := range files {
+		var (
+			text []byte
+			err  error
+		)
+		if file == "-" {
+			text, err = io.ReadAll(os.Stdin)
+		} else {
+			text, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := lwes.ParseText(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		events = append(events, parsed...)
+	}
+	return events, nil
+}
+
+// emitEvents emits the events count times, or until stopped with count
+// 0, paced at rate events per second, the failed ones included; it
+// returns the number emitted
+func emitEvents(em *lwes.Emitter, events []*lwes.LwesEvent, count int, rate float64, stop <-chan struct{}) int {
+	started := time.Now()
+	emitted, attempts := 0, 0
+	for n := 0; count == 0 || n < count; n++ {
+		for _, lwe := range events {
+			var due time.Time
+			if rate > 0 {
+				due = started.Add(time.Duration(float64(attempts) * float64(time.Second) / rate))
+			}
+			if !cli.WaitUntil(due, stop) {
+				return emitted
+			}
+
+			attempts++
+			if err := em.Emit(lwe); err != nil {
+				log.Printf("failed to emit %q: %v\n", lwe.Name, err)
+				continue
+			}
+			emitted++
+		}
+	}
+	return emitted
+}
+
+func main() {
+	flag.Parse()
+
+	if count < 0 {
+		log.Fatalf("bad count %d\n", count)
+	}
+	if rate < 0 {
+		log.Fatalf("bad rate %v\n", rate)
+	}
+	files := flag.Args()
+	if len(texts) == 0 && len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	events, err := readEvents(texts, files)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(events) == 0 {
+		log.Fatalln("no events to emit")
+	}
+
+	if dryRun {
+		for _, lwe := range events {
+			lwe.FPrint(os.Stdout)
+		}
+		return
+	}
+
+	em, err := cli.OpenEmitter(emits)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer em.Close()
+
+	emitted := emitEvents(em, events, count, rate, cli.StopOnSignal(0))
+	fmt.Fprintf(os.Stderr, "%d events emitted\n", emitted)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/lwestest"
+)
+
+func TestEmitEvents(t *testing.T) {
+	events, err := readEvents([]string{
+		`Test::A { uint16 i = 1; }`,
+		`Test::B { msg = "hello"; } Test::A { uint16 i = 2; }`,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	// 6 events at 200 per second, the last one 25ms after the first
+	began := time.Now()
+	if n := emitEvents(bus.Emitter(), events, 2, 200, make(chan struct{})); n != 6 {
+		t.Fatalf("got %d events emitted, want 6", n)
+	}
+	if took := time.Since(began); took < 25*time.Millisecond {
+		t.Fatalf("emitted in %v, faster than the rate", took)
+	}
+	for i := 0; i < 2; i++ {
+		bus.ExpectEvent(t, "Test::A", map[string]interface{}{"i": uint16(1)})
+		bus.ExpectEvent(t, "Test::B", map[string]interface{}{"msg": "hello"})
+		bus.ExpectEvent(t, "Test::A", map[string]interface{}{"i": uint16(2)})
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if n := emitEvents(bus.Emitter(), events, 0, 0, stop); n != 0 {
+		t.Fatalf("got %d events emitted once stopped, want 0", n)
+	}
+}
+
+func TestEmitEventsFailing(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	// too large to emit, still paced: 3 attempts at 100 per second
+	lwe := lwes.NewLwesEvent("Test::Large")
+	lwe.Set("s", strings.Repeat("x", lwes.MAX_FRAME_SIZE))
+	began := time.Now()
+	if n := emitEvents(bus.Emitter(), []*lwes.LwesEvent{lwe}, 3, 100, make(chan struct{})); n != 0 {
+		t.Fatalf("got %d events emitted, want 0", n)
+	}
+	if took := time.Since(began); took < 20*time.Millisecond {
+		t.Fatalf("attempted in %v, faster than the rate", took)
+	}
+}
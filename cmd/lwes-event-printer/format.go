@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/lwes/lwes-go"
+)
+
+// the output formats
+const (
+	formatClassic = "classic" // as the lwes-event-printing-listener of the C library
+	formatJSON    = "json"    // JSON lines
+	formatLogfmt  = "logfmt"
+	formatCompact = "compact" // a single line of the name and the attrs
+)
+
+// the ANSI colors of the name and the keys
+const (
+	colorName  = "\x1b[1;36m"
+	colorKey   = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+type printer struct {
+	format string
+	attrs  []string // the attrs printed, in this order; nil for all
+	color  bool
+}
+
+func validFormat(format string) bool {
+	switch format {
+	case formatClassic, formatJSON, formatLogfmt, formatCompact:
+		return true
+	}
+	return false
+}
+
+// enumerate the selected attrs of the event
+func (p *printer) enumerate(lwe *lwes.LwesEvent, callback func(key string, value interface{})) {
+	if p.attrs == nil {
+		lwe.Enumerate(func(key string, value interface{}) bool {
+			callback(key, value)
+			return true
+		})
+		return
+	}
+	for _, key := range p.attrs {
+		if value, ok := lwe.Attrs[key]; ok {
+			callback(key, value)
+		}
+	}
+}
+
+func (p *printer) paint(color, s string) string {
+	if !p.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func (p *printer) print(w io.Writer, lwe *lwes.LwesEvent) {
+	switch p.format {
+	case formatJSON:
+		p.printJSON(w, lwe)
+	case formatLogfmt:
+		p.printLogfmt(w, lwe)
+	case formatCompact:
+		p.printCompact(w, lwe)
+	default:
+		p.printClassic(w, lwe)
+	}
+}
+
+func (p *printer) printClassic(w io.Writer, lwe *lwes.LwesEvent) {
+	var sb strings.Builder
+	n := 0
+	p.enumerate(lwe, func(key string, value interface{}) {
+		fmt.Fprintf(&sb, "\t%s = %s;\n", p.paint(colorKey, key), formatValue(value))
+		n++
+	})
+	fmt.Fprintf(w, "%s[%d]\n{\n%s}\n", p.paint(colorName, lwe.Name), n, sb.String())
+}
+
+// printJSON prints the event of the selected attrs in the plain JSON
+// form of the library
+func (p *printer) printJSON(w io.Writer, lwe *lwes.LwesEvent) {
+	selected := lwes.NewLwesEvent(lwe.Name)
+	p.enumerate(lwe, func(key string, value interface{}) {
+		selected.Set(key, value)
+	})
+	js, err := selected.EncodeJSON(lwes.JSONPlain)
+	if err != nil {
+		log.Printf("failed to encode %q in JSON: %v\n", lwe.Name, err)
+		return
+	}
+	w.Write(append(js, '\n'))
+}
+
+func (p *printer) printLogfmt(w io.Writer, lwe *lwes.LwesEvent) {
+	var sb strings.Builder
+	sb.WriteString(p.paint(colorKey, "event") + "=" + p.paint(colorName, logfmtValue(lwe.Name)))
+	p.enumerate(lwe, func(key string, value interface{}) {
+		sb.WriteString(" " + p.paint(colorKey, key) + "=" + logfmtValue(formatValue(value)))
+	})
+	sb.WriteString("\n")
+	io.WriteString(w, sb.String())
+}
+
+func (p *printer) printCompact(w io.Writer, lwe *lwes.LwesEvent) {
+	var sb strings.Builder
+	sb.WriteString(p.paint(colorName, lwe.Name))
+	p.enumerate(lwe, func(key string, value interface{}) {
+		sb.WriteString(" " + p.paint(colorKey, key) + "=" + formatValue(value))
+	})
+	sb.WriteString("\n")
+	io.WriteString(w, sb.String())
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case net.IP:
+		return v.String()
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// logfmtValue quotes a value which is empty or has spaces, quotes,
+// equal signs or control characters
+func logfmtValue(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/lwes/lwes-go"
+)
+
+func TestPrinter(t *testing.T) {
+	lwe := lwes.NewLwesEvent("Test::Event")
+	lwe.Set("count", int64(3))
+	lwe.Set("msg", "hello world")
+	lwe.Set("ip", net.IP{127, 0, 0, 1})
+
+	tests := []struct {
+		p    printer
+		want string
+	}{
+		{printer{format: formatClassic},
+			"Test::Event[3]\n{\n\tcount = 3;\n\tmsg = hello world;\n\tip = 127.0.0.1;\n}\n"},
+		{printer{format: formatJSON},
+			`{"EventName":"Test::Event","count":3,"msg":"hello world","ip":"127.0.0.1"}` + "\n"},
+		{printer{format: formatLogfmt},
+			`event=Test::Event count=3 msg="hello world" ip=127.0.0.1` + "\n"},
+		{printer{format: formatCompact},
+			"Test::Event count=3 msg=hello world ip=127.0.0.1\n"},
+		{printer{format: formatCompact, attrs: []string{"ip", "missing", "count"}},
+			"Test::Event ip=127.0.0.1 count=3\n"},
+		{printer{format: formatCompact, attrs: []string{"count"}, color: true},
+			colorName + "Test::Event" + colorReset + " " + colorKey + "count" + colorReset + "=3\n"},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		tt.p.print(&sb, lwe)
+		if got := sb.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.p.format, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Command lwes-event-printer listens on one or more lwes channels and
+// prints the events received, like the lwes-event-printing-listener of
+// the C library.
+//
+//	lwes-event-printer -listen 239.5.1.100:11311 -format logfmt -name 'MonDemand::*'
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+)
+
+var (
+	listens cli.ArrayFlags
+	names   cli.NameFilter
+
+	format   string
+	filter   string
+	attrs    string
+	color    string
+	count    int
+	duration time.Duration
+	workers  int
+)
+
+func init() {
+	flag.Var(&listens, "listen", cli.ListenUsage)
+	flag.Var(&names.Names, "name", "print the events of the names matching the glob pattern only, like 'MonDemand::*'; repeatable")
+	flag.Var(&names.Excludes, "exclude", "do not print the events of the names matching the glob pattern; repeatable")
+	flag.StringVar(&filter, "filter", "", "print the events matching the filter expression only, like 'name =~ \"MonDemand::.*\" && num > 0'")
+	flag.StringVar(&format, "format", formatClassic, "the output format: classic, json, logfmt or compact")
+	flag.StringVar(&attrs, "attrs", "", "the comma separated attrs to print, in this order (default all)")
+	flag.StringVar(&color, "color", "auto", "color the output: auto, always or never")
+	flag.IntVar(&count, "count", 0, "exit after printing this many events (default no limit)")
+	flag.DurationVar(&duration, "duration", 0, "exit after listening this long (default no limit)")
+	flag.IntVar(&workers, "workers", 1, "the decoding workers of each channel")
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func main() {
+	flag.Parse()
+
+	if !validFormat(format) {
+		log.Fatalf("unknown format %q\n", format)
+	}
+	if err := names.Validate(); err != nil {
+		log.Fatalln(err)
+	}
+	if len(listens) == 0 {
+		listens = cli.ArrayFlags{cli.DefaultListen}
+	}
+	cfg := lwes.LwesModeConfig{Workers: workers}
+	if filter != "" {
+		f, err := lwes.CompileFilter(filter)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		cfg.Filter = f
+	}
+
+	p := &printer{format: format}
+	if attrs != "" {
+		p.attrs = strings.Split(attrs, ",")
+	}
+	switch color {
+	case "always":
+		p.color = true
+	case "auto":
+		p.color = isTerminal(os.Stdout)
+	}
+
+	// merge the events of all the channels
+	events := make(chan *lwes.LwesEvent, 1024)
+	var servers []lwes.Server
+	var wg sync.WaitGroup
+	for _, addr := range listens {
+		server, err := lwes.Listen(addr)
+		if err != nil {
+			log.Fatalf("failed to listen on %q: %v\n", addr, err)
+		}
+		servers = append(servers, server)
+		ls, ok := server.(lwes.LwesModeServer)
+		if !ok {
+			log.Fatalf("the server of %q does not decode with a config\n", addr)
+		}
+
+		wg.Add(1)
+		go func(out <-chan *lwes.LwesEvent) {
+			defer wg.Done()
+			for lwe := range out {
+				events <- lwe
+			}
+		}(ls.WaitLwesModeWith(cfg))
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	var stopping sync.Once
+	stop := func() {
+		stopping.Do(func() {
+			for _, server := range servers {
+				go server.Stop()
+			}
+		})
+	}
+
+	go func() {
+		<-cli.StopOnSignal(duration)
+		stop()
+	}()
+
+	w := bufio.NewWriter(os.Stdout)
+	printed := 0
+	for lwe := range events {
+		if count > 0 && printed >= count {
+			continue // draining after stopping
+		}
+		if !names.Match(lwe.Name) {
+			continue
+		}
+		p.print(w, lwe)
+		printed++
+
+		// flush once there is nothing more to print right away
+		if len(events) == 0 {
+			if err := w.Flush(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				stop()
+			}
+		}
+		if count > 0 && printed >= count {
+			stop()
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,146 @@
+// Command lwes-journal-replay emits the events of lwes journals again,
+// at the original speed, accelerated, or as fast as possible.
+//
+//	lwes-journal-replay -emit lwes::239.5.1.100:11311 -speed 10 all_events.log.1000.4600.gz
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+	"github.com/lwes/lwes-go/journal"
+)
+
+var (
+	emits cli.ArrayFlags
+	names cli.NameFilter
+
+	speed    float64
+	from, to string
+)
+
+func init() {
+	flag.Var(&emits, "emit", cli.EmitUsage)
+	flag.Var(&names.Names, "name", "replay the events of the names matching the glob pattern only, like 'MonDemand::*'; repeatable")
+	flag.Var(&names.Excludes, "exclude", "do not replay the events of the names matching the glob pattern; repeatable")
+	flag.Float64Var(&speed, "speed", 1, "the speed relative to the receipt times, like 10 for 10x; 0 for as fast as possible")
+	flag.StringVar(&from, "from", "", "replay the events received at or after this RFC 3339 time only")
+	flag.StringVar(&to, "to", "", "replay the events received before this RFC 3339 time only")
+}
+
+func parseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		log.Fatalf("bad time %q: %v\n", s, err)
+	}
+	return t
+}
+
+// replayer paces the events by their receipt times
+type replayer struct {
+	em       *lwes.Emitter
+	speed    float64
+	from, to time.Time
+
+	first   time.Time // the receipt time of the first event replayed
+	started time.Time
+	emitted int
+}
+
+func (r *replayer) replay(jr *journal.Reader, stop <-chan struct{}) error {
+	for {
+		h, event, err := jr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name, err := lwes.PeekName(event)
+		if err != nil {
+			log.Printf("skipping an invalid event: %v\n", err)
+			continue
+		}
+		if (!r.from.IsZero() && h.ReceiptTime.Before(r.from)) ||
+			(!r.to.IsZero() && !h.ReceiptTime.Before(r.to)) ||
+			!names.Match(name) {
+			continue
+		}
+
+		var due time.Time
+		if r.first.IsZero() {
+			r.first, r.started = h.ReceiptTime, time.Now()
+		} else if r.speed > 0 {
+			due = r.started.Add(time.Duration(float64(h.ReceiptTime.Sub(r.first)) / r.speed))
+		}
+		if !cli.WaitUntil(due, stop) {
+			return nil
+		}
+
+		if err := r.em.Emit(cli.RawEvent(event)); err != nil {
+			log.Printf("failed to emit %q: %v\n", name, err)
+			continue
+		}
+		r.emitted++
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if speed < 0 {
+		log.Fatalf("bad speed %v\n", speed)
+	}
+	if err := names.Validate(); err != nil {
+		log.Fatalln(err)
+	}
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	em, err := cli.OpenEmitter(emits)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer em.Close()
+
+	stop := cli.StopOnSignal(0)
+
+	r := &replayer{em: em, speed: speed, from: parseTime(from), to: parseTime(to)}
+	for _, file := range files {
+		if cli.Stopped(stop) {
+			break
+		}
+
+		var (
+			jr  *journal.Reader
+			err error
+		)
+		if file == "-" {
+			jr, err = journal.NewReader(os.Stdin)
+		} else {
+			jr, err = journal.OpenReader(file)
+		}
+		if err != nil {
+			log.Fatalf("failed to open %q: %v\n", file, err)
+		}
+
+		err = r.replay(jr, stop)
+		jr.Close()
+		if err != nil {
+			log.Printf("failed to read %q: %v\n", file, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d events replayed\n", r.emitted)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+	"github.com/lwes/lwes-go/journal"
+	"github.com/lwes/lwes-go/lwestest"
+)
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	w := journal.NewWriter(&buf)
+	start := time.Unix(1000, 0)
+	for i, name := range []string{"Test::A", "Test::B", "Test::A", "Test::A"} {
+		lwe := lwes.NewLwesEvent(name)
+		lwe.Set("i", int64(i))
+		event, _ := lwes.Marshal(lwe)
+		w.WriteEvent(journal.Header{ReceiptTime: start.Add(time.Duration(i) * 100 * time.Millisecond)}, event)
+	}
+
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	names = cli.NameFilter{Names: cli.ArrayFlags{"Test::A"}}
+	defer func() { names = cli.NameFilter{} }()
+
+	// from the second event, at 10x: the two events of Test::A left, 100ms
+	// apart, in 10ms
+	r := &replayer{em: bus.Emitter(), speed: 10, from: start.Add(100 * time.Millisecond)}
+	jr, _ := journal.NewReader(&buf)
+	began := time.Now()
+	if err := r.replay(jr, make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(began); took < 10*time.Millisecond {
+		t.Fatalf("replayed in %v, faster than 10x", took)
+	}
+	if r.emitted != 2 {
+		t.Fatalf("got %d events replayed, want 2", r.emitted)
+	}
+	bus.ExpectEvent(t, "Test::A", map[string]interface{}{"i": int64(2)})
+	bus.ExpectEvent(t, "Test::A", map[string]interface{}{"i": int64(3)})
+}
@@ -0,0 +1,113 @@
+// Command lwes-journaller archives the events of one or more lwes
+// channels to a gzipped journal, in the format of the lwes-journaller
+// of the C and Java libraries.
+//
+// The journal is rotated by size, by age, or on SIGHUP; it's closed on
+// SIGINT or SIGTERM.
+//
+//	lwes-journaller -listen 239.5.1.100:11311 -path all_events.log.gz -max-age 1h
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+	"github.com/lwes/lwes-go/journal"
+)
+
+var (
+	listens cli.ArrayFlags
+	cfg     journal.FileConfig
+	siteID  uint
+)
+
+func init() {
+	flag.Var(&listens, "listen", cli.ListenUsage)
+	flag.StringVar(&cfg.Path, "path", "all_events.log.gz", "the journal to write, gzipped if ending with .gz")
+	flag.Int64Var(&cfg.MaxSize, "max-size", 0, "rotate the journal after this many bytes of events (default no limit)")
+	flag.DurationVar(&cfg.MaxAge, "max-age", 0, "rotate the journal after this long (default no limit)")
+	flag.BoolVar(&cfg.Fsync, "fsync", false, "fsync the journal when synced, rotated and closed")
+	flag.DurationVar(&cfg.SyncInterval, "sync-interval", time.Second, "flush the events written this often; 0 to flush on rotating only")
+	flag.UintVar(&siteID, "site", 0, "the site id of the headers")
+}
+
+func main() {
+	flag.Parse()
+
+	if siteID > 0xffff {
+		log.Fatalf("site id %d out of range\n", siteID)
+	}
+	if len(listens) == 0 {
+		listens = cli.ArrayFlags{cli.DefaultListen}
+	}
+
+	fw, err := journal.OpenFile(cfg)
+	if err != nil {
+		log.Fatalf("failed to open the journal: %v\n", err)
+	}
+
+	var servers []lwes.Server
+	var wg sync.WaitGroup
+	for _, addr := range listens {
+		server, err := lwes.Listen(addr)
+		if err != nil {
+			log.Fatalf("failed to listen on %q: %v\n", addr, err)
+		}
+		servers = append(servers, server)
+
+		wg.Add(1)
+		go func(server lwes.Server) {
+			defer wg.Done()
+			for rb := range server.DataChan() {
+				h := journal.HeaderFrom(rb.Addr(), rb.ReceivedAt(), uint16(siteID))
+				if err := fw.WriteEvent(h, rb.Bytes()); err != nil {
+					log.Printf("failed to journal an event: %v\n", err)
+				}
+				rb.Done()
+			}
+		}(server)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case sig := <-sigs:
+			if sig == syscall.SIGHUP {
+				if err := fw.Rotate(); err != nil {
+					log.Printf("failed to rotate the journal: %v\n", err)
+				}
+				continue
+			}
+			log.Printf("got %v, stopping\n", sig)
+			for _, server := range servers {
+				go server.Stop()
+			}
+		case <-tick.C:
+			if err := fw.Tick(); err != nil {
+				log.Printf("failed to sync or rotate the journal: %v\n", err)
+			}
+		case <-done:
+			if err := fw.Close(); err != nil {
+				log.Fatalf("failed to close the journal: %v\n", err)
+			}
+			return
+		}
+	}
+}
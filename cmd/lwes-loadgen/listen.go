@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lwes/lwes-go"
+)
+
+// stream is the sequence of the events of a worker of a generator
+type stream struct {
+	received   int64
+	maxSeq     int64
+	outOfOrder int64
+}
+
+// lost returns the events missing up to the highest sequence number
+// received; the events lost after it are not known yet
+func (s *stream) lost() int64 {
+	if lost := s.maxSeq + 1 - s.received; lost > 0 {
+		return lost
+	}
+	return 0
+}
+
+// listener measures the loss and the latency of the events of the
+// generators, by their streams
+type listener struct {
+	mutex      sync.Mutex
+	streams    map[string]*stream
+	received   int64 // of the generators
+	unknown    int64 // events without a stream
+	maxLatency time.Duration
+
+	// of the interval reported
+	intvReceived int64
+	intvLost     int64 // lost at the start of the interval
+	latencies    []time.Duration
+}
+
+func newListener() *listener {
+	return &listener{streams: make(map[string]*stream)}
+}
+
+func (l *listener) observe(lwe *lwes.LwesEvent, now time.Time) {
+	name, _ := lwe.Attrs[streamKey].(string)
+	seq, ok1 := lwe.Attrs[seqKey].(int64)
+	sent, ok2 := lwe.Attrs[sentKey].(int64)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if name == "" || !ok1 || !ok2 {
+		l.unknown++
+		return
+	}
+	s := l.streams[name]
+	if s == nil {
+		s = &stream{maxSeq: -1}
+		l.streams[name] = s
+	}
+	s.received++
+	if seq > s.maxSeq {
+		s.maxSeq = seq
+	} else {
+		s.outOfOrder++
+	}
+
+	latency := now.Sub(time.Unix(0, sent))
+	if latency > l.maxLatency {
+		l.maxLatency = latency
+	}
+	l.latencies = append(l.latencies, latency)
+	l.received++
+	l.intvReceived++
+}
+
+// totals returns the events received, lost and out of order of all
+// the streams
+func (l *listener) totals() (received, lost, outOfOrder int64) {
+	for _, s := range l.streams {
+		lost += s.lost()
+		outOfOrder += s.outOfOrder
+	}
+	return l.received, lost, outOfOrder
+}
+
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
+
+// percentile of the sorted latencies
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	return latencies[int(p*float64(len(latencies)-1))]
+}
+
+// report returns the line of the interval, and starts a new interval
+func (l *listener) report(interval time.Duration) string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, lost, _ := l.totals()
+	intvLost := lost - l.intvLost
+	sort.Slice(l.latencies, func(i, j int) bool { return l.latencies[i] < l.latencies[j] })
+	line := fmt.Sprintf("received %d events in %v (%.0f/s), lost %d (%.2f%%), latency p50 %v p99 %v max %v",
+		l.intvReceived, interval, float64(l.intvReceived)/interval.Seconds(),
+		intvLost, percent(intvLost, l.intvReceived+intvLost),
+		percentile(l.latencies, 0.5), percentile(l.latencies, 0.99), percentile(l.latencies, 1))
+
+	l.intvReceived, l.intvLost = 0, lost
+	l.latencies = l.latencies[:0]
+	return line
+}
+
+// summary returns the line of the totals
+func (l *listener) summary(elapsed time.Duration) string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	received, lost, outOfOrder := l.totals()
+	return fmt.Sprintf("received %d events of %d streams in %v (%.0f/s), lost %d (%.2f%%), %d out of order, %d not of a generator, max latency %v",
+		received, len(l.streams), elapsed.Round(time.Millisecond), float64(received)/elapsed.Seconds(),
+		lost, percent(lost, received+lost), outOfOrder, l.unknown, l.maxLatency)
+}
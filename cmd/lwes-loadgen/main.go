@@ -0,0 +1,202 @@
+// Command lwes-loadgen sends events at a target rate or as fast as
+// possible to capacity test the listeners, and measures their loss and
+// latency with a listener mode.
+//
+// The events are the ones of a text template, of a journal, or random
+// ones of the events of an ESF; each of them is added a stream of the
+// worker sending it, a sequence number and the time it's sent at.
+//
+//	lwes-loadgen -emit lwes::239.5.1.100:11311 -esf events.esf -rate 50000 -workers 4 -duration 1m
+//	lwes-loadgen -listen 239.5.1.100:11311
+//
+// The latencies are of the clocks of the sending and the listening hosts.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+)
+
+var (
+	emits    cli.ArrayFlags
+	template string
+	journalF string
+	esf      string
+	strLen   int
+	rate     float64
+	count    int64
+	workers  int
+
+	listen   string
+	decoders int
+
+	duration time.Duration
+	interval time.Duration
+)
+
+func init() {
+	flag.Var(&emits, "emit", cli.EmitUsage)
+	flag.StringVar(&template, "template", "", "send the events of this text, like 'Test::Event { uint16 num = 1; }'")
+	flag.StringVar(&journalF, "journal", "", "send the events of this journal file")
+	flag.StringVar(&esf, "esf", "", "send random events of this ESF file")
+	flag.IntVar(&strLen, "string-len", 32, "the max length of the random strings")
+	flag.Float64Var(&rate, "rate", 0, "send this many events per second; 0 for as fast as possible")
+	flag.Int64Var(&count, "count", 0, "send this many events (default no limit)")
+	flag.IntVar(&workers, "workers", 1, "the goroutines sending the events")
+
+	flag.StringVar(&listen, "listen", "", "listen on the channel instead of sending, as <addr>:<port>, unix:<path> or tcp:<addr>:<port>, and report the loss and the latency")
+	flag.IntVar(&decoders, "decoders", 1, "the decoding workers of the listener; more than 1 reorders the events")
+
+	flag.DurationVar(&duration, "duration", 0, "stop after this long (default no limit)")
+	flag.DurationVar(&interval, "interval", time.Second, "report this often")
+}
+
+// sources returns the function making the source of each worker
+func sources() (func(worker int) source, error) {
+	var n int
+	for _, s := range []string{template, journalF, esf} {
+		if s != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("one of -template, -journal and -esf is required")
+	}
+
+	var events []*lwes.LwesEvent
+	var err error
+	switch {
+	case esf != "":
+		text, err := os.ReadFile(esf)
+		if err != nil {
+			return nil, err
+		}
+		specs, err := lwes.ParseESF(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", esf, err)
+		}
+		if len(specs) == 0 || (len(specs) == 1 && specs[0].Name == lwes.MetaEventInfo) {
+			return nil, fmt.Errorf("%s: no events", esf)
+		}
+		return newRandomSources(specs, strLen), nil
+	case journalF != "":
+		events, err = readJournal(journalF)
+	default:
+		events, err = lwes.ParseText(template)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no events to send")
+	}
+	return newCycleSources(events)
+}
+
+func main() {
+	flag.Parse()
+
+	if interval <= 0 {
+		log.Fatalf("bad interval %v\n", interval)
+	}
+
+	stop := cli.StopOnSignal(duration)
+
+	if listen != "" {
+		runListener(stop)
+	} else {
+		runGenerator(stop)
+	}
+}
+
+func runGenerator(stop <-chan struct{}) {
+	if workers <= 0 || rate < 0 || count < 0 || strLen <= 0 {
+		log.Fatalln("bad -workers, -rate, -count or -string-len")
+	}
+	src, err := sources()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	em, err := cli.OpenEmitter(emits)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer em.Close()
+
+	g := &generator{
+		em:      em,
+		sources: src,
+		run:     fmt.Sprintf("%d.%d", os.Getpid(), time.Now().UnixNano()),
+		workers: workers,
+		rate:    rate,
+		count:   count,
+	}
+	started := time.Now()
+	done := g.start(stop)
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	last, lastAt := int64(0), started
+loop:
+	for {
+		select {
+		case now := <-tick.C:
+			sent := g.sentCount()
+			fmt.Printf("sent %d events in %v (%.0f/s), %d errors\n",
+				sent-last, interval, float64(sent-last)/now.Sub(lastAt).Seconds(), g.errorCount())
+			last, lastAt = sent, now
+		case <-done:
+			break loop
+		}
+	}
+
+	elapsed := time.Since(started)
+	m := em.Metrics()
+	fmt.Printf("sent %d events, %d bytes total, in %v (%.0f/s), %d errors, %d too large\n",
+		g.sentCount(), m.BytesEmitted, elapsed.Round(time.Millisecond),
+		float64(g.sentCount())/elapsed.Seconds(), g.errorCount(), m.EventsTooLarge)
+}
+
+func runListener(stop <-chan struct{}) {
+	if decoders <= 0 {
+		log.Fatalf("bad decoders %d\n", decoders)
+	}
+	server, err := lwes.Listen(listen)
+	if err != nil {
+		log.Fatalf("failed to listen on %q: %v\n", listen, err)
+	}
+
+	l := newListener()
+	events := server.WaitLwesMode(decoders)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for lwe := range events {
+			l.observe(lwe, time.Now())
+		}
+	}()
+
+	started := time.Now()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+loop:
+	for {
+		select {
+		case <-tick.C:
+			fmt.Println(l.report(interval))
+		case <-stop:
+			break loop
+		}
+	}
+
+	server.Stop()
+	<-done
+	fmt.Println(l.summary(time.Since(started)))
+}
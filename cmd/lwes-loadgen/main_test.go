@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/lwestest"
+)
+
+func TestLoadgen(t *testing.T) {
+	specs, err := lwes.ParseESF(`
+MetaEventInfo { int64 ReceiptTime; }
+Test::A { uint16 num = 7; string msg; ip_addr ip; double d; }
+Test::B { int32 i; boolean ok; }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := lwestest.NewBus(lwestest.Config{Seed: 1, Loss: 0.1})
+	l := newListener()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for lwe := range bus.Events() {
+			if lwe.Name == "Test::A" && lwe.Attrs["num"] != uint16(7) {
+				t.Errorf("got num %v, want the default 7", lwe.Attrs["num"])
+			}
+			l.observe(lwe, time.Now())
+		}
+	}()
+
+	g := &generator{
+		em:      bus.Emitter(),
+		sources: newRandomSources(specs, 8),
+		run:     "test",
+		workers: 3,
+		rate:    20000,
+		count:   200,
+	}
+	<-g.start(make(chan struct{}))
+	bus.Close()
+	wg.Wait()
+
+	if g.sentCount() != 200 || g.errorCount() != 0 {
+		t.Fatalf("got %d events sent and %d errors, want 200 and 0", g.sentCount(), g.errorCount())
+	}
+	received, lost, _ := l.totals()
+	if len(l.streams) != 3 || lost == 0 || received+lost > 200 || received+lost < 190 {
+		t.Fatalf("got %d streams, %d events received and %d lost of 200", len(l.streams), received, lost)
+	}
+	if line := l.summary(time.Second); !strings.Contains(line, "lost") {
+		t.Fatalf("unexpected summary %q", line)
+	}
+}
+
+func TestCycleSources(t *testing.T) {
+	events, _ := lwes.ParseText(`Test::A { uint16 i = 1; } Test::B { uint16 i = 2; }`)
+	sources, err := newCycleSources(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each worker has its own copies to set the attrs of
+	s1, s2 := sources(0), sources(1)
+	a1, a2 := s1.next(), s2.next()
+	if a1 == a2 || a1.Name != "Test::A" || s1.next().Name != "Test::B" || s1.next() != a1 {
+		t.Fatalf("unexpected events of the sources")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+	"github.com/lwes/lwes-go/journal"
+)
+
+// the attrs added to the events sent, for the listener to measure the
+// loss and the latency
+const (
+	streamKey = "LoadgenStream" // the run and the worker, of its own sequence
+	seqKey    = "LoadgenSeq"    // from 0 in each stream
+	sentKey   = "LoadgenSentAt" // unix nanoseconds
+)
+
+// source makes the events sent by a worker
+type source interface {
+	next() *lwes.LwesEvent
+}
+
+// cycleSource sends the same events over and over
+type cycleSource struct {
+	events []*lwes.LwesEvent
+	i      int
+}
+
+func (s *cycleSource) next() *lwes.LwesEvent {
+	lwe := s.events[s.i]
+	s.i = (s.i + 1) % len(s.events)
+	return lwe
+}
+
+// newCycleSources returns a function making a cycleSource of a copy of
+// the events for each worker, as the workers set the attrs of the events
+func newCycleSources(events []*lwes.LwesEvent) (func(worker int) source, error) {
+	var encoded [][]byte
+	for _, lwe := range events {
+		event, err := lwes.Marshal(lwe)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", lwe.Name, err)
+		}
+		encoded = append(encoded, event)
+	}
+	return func(int) source {
+		s := &cycleSource{}
+		for _, event := range encoded {
+			lwe := new(lwes.LwesEvent)
+			lwes.Unmarshal(event, lwe)
+			s.events = append(s.events, lwe)
+		}
+		return s
+	}, nil
+}
+
+// readJournal returns the events of a journal file
+func readJournal(path string) ([]*lwes.LwesEvent, error) {
+	jr, err := journal.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer jr.Close()
+
+	var events []*lwes.LwesEvent
+	for {
+		_, event, err := jr.Next()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		lwe := new(lwes.LwesEvent)
+		if err := lwes.Unmarshal(event, lwe); err != nil {
+			log.Printf("skipping an invalid event of %q: %v\n", path, err)
+			continue
+		}
+		events = append(events, lwe)
+	}
+}
+
+// randomSource makes the events of an ESF, with random values for the
+// attrs without a default
+type randomSource struct {
+	events []lwes.ESFEvent
+	rand   *rand.Rand
+	strLen int
+	i      int
+}
+
+func newRandomSources(events []lwes.ESFEvent, strLen int) func(worker int) source {
+	var specs []lwes.ESFEvent
+	for _, ev := range events {
+		if ev.Name != lwes.MetaEventInfo {
+			specs = append(specs, ev)
+		}
+	}
+	return func(worker int) source {
+		return &randomSource{
+			events: specs,
+			rand:   rand.New(rand.NewSource(time.Now().UnixNano() + int64(worker))),
+			strLen: strLen,
+		}
+	}
+}
+
+func (s *randomSource) next() *lwes.LwesEvent {
+	ev := s.events[s.i]
+	s.i = (s.i + 1) % len(s.events)
+
+	lwe := lwes.NewLwesEvent(ev.Name)
+	for _, attr := range ev.Attrs {
+		if attr.Default != nil {
+			lwe.Set(attr.Key, attr.Default)
+		} else {
+			lwe.Set(attr.Key, s.value(attr.Type))
+		}
+	}
+	return lwe
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func (s *randomSource) value(typ string) interface{} {
+	r := s.rand
+	switch typ {
+	case "uint16":
+		return uint16(r.Uint32())
+	case "int16":
+		return int16(r.Uint32())
+	case "uint32":
+		return r.Uint32()
+	case "int32":
+		return int32(r.Uint32())
+	case "int64":
+		return int64(r.Uint64())
+	case "uint64":
+		return r.Uint64()
+	case "boolean":
+		return r.Intn(2) == 1
+	case "byte":
+		return byte(r.Uint32())
+	case "float":
+		return r.Float32()
+	case "double":
+		return r.Float64()
+	case "ip_addr":
+		return net.IPv4(byte(r.Uint32()), byte(r.Uint32()), byte(r.Uint32()), byte(r.Uint32())).To4()
+	}
+	// the strings
+	b := make([]byte, 1+r.Intn(s.strLen))
+	for i := range b {
+		b[i] = letters[r.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+// generator sends the events of its sources by workers, paced to share
+// the rate
+type generator struct {
+	em      *lwes.Emitter
+	sources func(worker int) source
+	run     string // the id of the run, prefixing the streams
+	workers int
+	rate    float64 // events per second of all the workers; 0 for max speed
+	count   int64   // events of all the workers; 0 until stopped
+
+	sent   int64 // atomic
+	errors int64 // atomic
+}
+
+// start the workers; the returned channel is closed when they are done
+func (g *generator) start(stop <-chan struct{}) <-chan struct{} {
+	var wg sync.WaitGroup
+	for w := 0; w < g.workers; w++ {
+		count := g.count / int64(g.workers)
+		if int64(w) < g.count%int64(g.workers) {
+			count++
+		}
+		if g.count > 0 && count == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(w int, count int64) {
+			defer wg.Done()
+			g.work(w, count, stop)
+		}(w, count)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func (g *generator) sentCount() int64 {
+	return atomic.LoadInt64(&g.sent)
+}
+
+func (g *generator) errorCount() int64 {
+	return atomic.LoadInt64(&g.errors)
+}
+
+func (g *generator) work(worker int, count int64, stop <-chan struct{}) {
+	src := g.sources(worker)
+	stream := fmt.Sprintf("%s/%d", g.run, worker)
+	rate := g.rate / float64(g.workers)
+	started := time.Now()
+
+	for seq := int64(0); count == 0 || seq < count; seq++ {
+		var due time.Time
+		if rate > 0 {
+			due = started.Add(time.Duration(float64(seq) * float64(time.Second) / rate))
+		}
+		if !cli.WaitUntil(due, stop) {
+			return
+		}
+
+		lwe := src.next()
+		lwe.Set(streamKey, stream)
+		lwe.Set(seqKey, seq)
+		lwe.Set(sentKey, time.Now().UnixNano())
+		if err := g.em.Emit(lwe); err != nil {
+			if atomic.AddInt64(&g.errors, 1) == 1 {
+				log.Printf("failed to emit %q: %v\n", lwe.Name, err)
+			}
+			continue
+		}
+		atomic.AddInt64(&g.sent, 1)
+	}
+}
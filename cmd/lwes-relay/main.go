@@ -0,0 +1,181 @@
+// Command lwes-relay forwards the events of one or more lwes channels,
+// like multicast groups, to one or more others, like the unicast
+// addresses of the segments not receiving the groups.
+//
+// The events are forwarded as received, unless they are rewritten or
+// marked against the loops of relays forwarding to each other.
+//
+//	lwes-relay -listen 239.5.1.100:11311 -emit lwes-udp:10.1.2.3:11311 -name 'MonDemand::*' -marker RelayedBy
+//
+// The metrics of the relay, of its listeners and of its emitter are
+// served in the Prometheus format on /metrics and with expvar on
+// /debug/vars of -metrics-addr.
+package main
+
+import (
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+)
+
+var (
+	listens cli.ArrayFlags
+	emits   cli.ArrayFlags
+	names   cli.NameFilter
+
+	sets    cli.ArrayFlags
+	renames cli.ArrayFlags
+	deletes cli.ArrayFlags
+
+	rate   float64
+	burst  float64
+	marker string
+	id     string
+
+	metricsAddr string
+)
+
+func init() {
+	flag.Var(&listens, "listen", cli.ListenUsage)
+	flag.Var(&emits, "emit", "the channel to relay to, like lwes::<ip>:<port>, lwes-udp:<ip>:<port>, lwes-tcp:<host>:<port> or lwes-unix:<path>; repeatable")
+	flag.Var(&names.Names, "name", "relay the events of the names matching the glob pattern only, like 'MonDemand::*'; repeatable")
+	flag.Var(&names.Excludes, "exclude", "do not relay the events of the names matching the glob pattern; repeatable")
+	flag.Var(&sets, "set", "set the attr of the text, like 'uint16 SiteID = 2'; repeatable")
+	flag.Var(&renames, "rename", "rename the attr, like old=new; repeatable")
+	flag.Var(&deletes, "delete", "delete the attr; repeatable")
+	flag.Float64Var(&rate, "rate", 0, "relay this many events per second at most, dropping the others (default no limit)")
+	flag.Float64Var(&burst, "burst", 0, "relay this many events at once under the -rate (default the rate)")
+	flag.StringVar(&marker, "marker", "", "the attr of the ids of the relays an event went through, not to relay it twice (default no marker)")
+	flag.StringVar(&id, "id", "", "the id of the relay in the -marker (default the hostname)")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "serve the metrics on this address, like :9110")
+}
+
+// parseRewrite returns the rewrite of the -set, -rename and -delete flags
+func parseRewrite() (rewrite, error) {
+	rw := rewrite{
+		set:    lwes.NewLwesEvent(""),
+		rename: make(map[string]string),
+		delete: make(map[string]bool),
+	}
+	for _, s := range sets {
+		events, err := lwes.ParseText("Set {" + s + "}")
+		if err != nil {
+			return rw, fmt.Errorf("bad -set %q: %w", s, err)
+		}
+		events[0].Enumerate(func(key string, value interface{}) bool {
+			rw.set.Set(key, value)
+			return true
+		})
+	}
+	for _, s := range renames {
+		from, to, ok := strings.Cut(s, "=")
+		if !ok || from == "" || to == "" {
+			return rw, fmt.Errorf("bad -rename %q", s)
+		}
+		rw.rename[from] = to
+	}
+	for _, key := range deletes {
+		rw.delete[key] = true
+	}
+	return rw, nil
+}
+
+func main() {
+	flag.Parse()
+
+	if len(listens) == 0 {
+		listens = cli.ArrayFlags{cli.DefaultListen}
+	}
+	if len(emits) == 0 {
+		log.Fatalln("no -emit to relay to")
+	}
+	if err := names.Validate(); err != nil {
+		log.Fatalln(err)
+	}
+	if rate < 0 || burst < 0 {
+		log.Fatalln("bad -rate or -burst")
+	}
+	rw, err := parseRewrite()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if id == "" {
+		if id, err = os.Hostname(); err != nil {
+			log.Fatalf("failed to get the hostname for the id: %v\n", err)
+		}
+	}
+	if strings.Contains(id, ",") {
+		log.Fatalf("bad id %q\n", id)
+	}
+
+	em, err := cli.OpenEmitter(emits)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer em.Close()
+
+	r := &relay{
+		em:      em,
+		names:   names,
+		rewrite: rw,
+		marker:  marker,
+		id:      id,
+	}
+	if rate > 0 {
+		if burst == 0 {
+			burst = rate
+		}
+		r.limiter = newLimiter(rate, burst)
+	}
+
+	handler := lwes.NewMetricsHandler()
+	handler.AddEmitter("relay", em)
+	handler.AddMetrics("lwes-relay", func() interface{} { return r.snapshot() })
+	expvar.Publish("lwes-relay", expvar.Func(func() interface{} { return r.snapshot() }))
+
+	var servers []lwes.Server
+	var wg sync.WaitGroup
+	for _, addr := range listens {
+		server, err := lwes.Listen(addr)
+		if err != nil {
+			log.Fatalf("failed to listen on %q: %v\n", addr, err)
+		}
+		servers = append(servers, server)
+		handler.AddServer(server)
+
+		wg.Add(1)
+		go func(server lwes.Server) {
+			defer wg.Done()
+			for rb := range server.DataChan() {
+				r.forward(rb.Bytes())
+				rb.Done()
+			}
+		}(server)
+	}
+
+	if metricsAddr != "" {
+		http.Handle("/metrics", handler)
+		go func() {
+			log.Fatalln(http.ListenAndServe(metricsAddr, nil))
+		}()
+	}
+
+	<-cli.StopOnSignal(0)
+	log.Println("stopping")
+	for _, server := range servers {
+		server.Stop()
+	}
+	wg.Wait()
+
+	m := r.snapshot()
+	fmt.Fprintf(os.Stderr, "%d events received, %d forwarded, %d filtered, %d looped, %d rate limited, %d invalid, %d emit errors\n",
+		m.EventsReceived, m.EventsForwarded, m.EventsFiltered, m.EventsLooped, m.EventsRateLimited, m.EventsInvalid, m.EmitErrors)
+}
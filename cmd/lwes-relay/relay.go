@@ -0,0 +1,195 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+)
+
+// relayMetrics of the events received from all the inputs
+type relayMetrics struct {
+	EventsReceived    int64 `mondemand_stat:"events_received"`
+	EventsForwarded   int64 `mondemand_stat:"events_forwarded"`
+	EventsFiltered    int64 `mondemand_stat:"events_filtered"`
+	EventsLooped      int64 `mondemand_stat:"events_looped"`
+	EventsRateLimited int64 `mondemand_stat:"events_rate_limited"`
+	EventsInvalid     int64 `mondemand_stat:"events_invalid"`
+	EmitErrors        int64 `mondemand_stat:"emit_errors"`
+}
+
+// limiter is a token bucket of rate tokens per second, holding burst
+// tokens at most
+type limiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate, burst float64) *limiter {
+	return &limiter{rate: rate, burst: burst, tokens: burst}
+}
+
+func (l *limiter) allow(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// rewrite of the attrs of the events relayed
+type rewrite struct {
+	set    *lwes.LwesEvent   // the attrs set, in order
+	rename map[string]string // the old keys to the new ones
+	delete map[string]bool
+}
+
+func (rw *rewrite) empty() bool {
+	return len(rw.set.Attrs) == 0 && len(rw.rename) == 0 && len(rw.delete) == 0
+}
+
+// apply returns the event rewritten, keeping the order of the attrs, the
+// attrs set and not in the event being last
+func (rw *rewrite) apply(lwe *lwes.LwesEvent) *lwes.LwesEvent {
+	out := lwes.NewLwesEvent(lwe.Name)
+	lwe.Enumerate(func(key string, value interface{}) bool {
+		if rw.delete[key] {
+			return true
+		}
+		if to, ok := rw.rename[key]; ok {
+			key = to
+		}
+		if v, ok := rw.set.Attrs[key]; ok {
+			value = v
+		}
+		out.Set(key, value)
+		return true
+	})
+	rw.set.Enumerate(func(key string, value interface{}) bool {
+		if _, ok := out.Attrs[key]; !ok {
+			out.Set(key, value)
+		}
+		return true
+	})
+	return out
+}
+
+// relay forwards the events received to the emitter
+type relay struct {
+	em      *lwes.Emitter
+	names   cli.NameFilter // of the names relayed
+	limiter *limiter       // nil for no limit
+	rewrite rewrite
+
+	// marker is the key of the ids of the relays an event went through,
+	// comma separated, not to relay it twice; "" for no marker
+	marker string
+	id     string
+
+	metrics relayMetrics
+}
+
+func (r *relay) count(p *int64) {
+	atomic.AddInt64(p, 1)
+}
+
+// snapshot returns the metrics of the relay
+func (r *relay) snapshot() relayMetrics {
+	return relayMetrics{
+		EventsReceived:    atomic.LoadInt64(&r.metrics.EventsReceived),
+		EventsForwarded:   atomic.LoadInt64(&r.metrics.EventsForwarded),
+		EventsFiltered:    atomic.LoadInt64(&r.metrics.EventsFiltered),
+		EventsLooped:      atomic.LoadInt64(&r.metrics.EventsLooped),
+		EventsRateLimited: atomic.LoadInt64(&r.metrics.EventsRateLimited),
+		EventsInvalid:     atomic.LoadInt64(&r.metrics.EventsInvalid),
+		EmitErrors:        atomic.LoadInt64(&r.metrics.EmitErrors),
+	}
+}
+
+// forward an encoded event, as is unless it's marked or rewritten
+func (r *relay) forward(event []byte) {
+	r.count(&r.metrics.EventsReceived)
+
+	name, err := lwes.PeekName(event)
+	if err != nil {
+		r.count(&r.metrics.EventsInvalid)
+		return
+	}
+	if !r.names.Match(name) {
+		r.count(&r.metrics.EventsFiltered)
+		return
+	}
+
+	var lwe *lwes.LwesEvent
+	if r.marker != "" || !r.rewrite.empty() {
+		lwe = new(lwes.LwesEvent)
+		if err := lwes.Unmarshal(event, lwe); err != nil {
+			r.count(&r.metrics.EventsInvalid)
+			return
+		}
+		if r.marker != "" && r.looped(lwe) {
+			r.count(&r.metrics.EventsLooped)
+			return
+		}
+	}
+
+	if r.limiter != nil && !r.limiter.allow(time.Now()) {
+		r.count(&r.metrics.EventsRateLimited)
+		return
+	}
+
+	if lwe == nil {
+		err = r.em.Emit(cli.RawEvent(event))
+	} else {
+		if !r.rewrite.empty() {
+			lwe = r.rewrite.apply(lwe)
+		}
+		if r.marker != "" {
+			r.mark(lwe)
+		}
+		err = r.em.Emit(lwe)
+	}
+	if err != nil {
+		r.count(&r.metrics.EmitErrors)
+		return
+	}
+	r.count(&r.metrics.EventsForwarded)
+}
+
+// looped reports whether the event went through this relay already
+func (r *relay) looped(lwe *lwes.LwesEvent) bool {
+	ids, _ := lwe.Attrs[r.marker].(string)
+	for _, id := range strings.Split(ids, ",") {
+		if id == r.id {
+			return true
+		}
+	}
+	return false
+}
+
+// mark adds the id of the relay to the marker of the event
+func (r *relay) mark(lwe *lwes.LwesEvent) {
+	ids, ok := lwe.Attrs[r.marker].(string)
+	if !ok || ids == "" {
+		ids = r.id
+	} else {
+		ids += "," + r.id
+	}
+	lwe.Set(r.marker, ids)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/internal/cli"
+	"github.com/lwes/lwes-go/lwestest"
+)
+
+func encode(t *testing.T, text string) []byte {
+	events, err := lwes.ParseText(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := lwes.Marshal(events[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestRelay(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{Timeout: 200 * time.Millisecond})
+	defer bus.Close()
+
+	sets, renames, deletes = cli.ArrayFlags{"uint16 SiteID = 2"}, cli.ArrayFlags{"old=new"}, cli.ArrayFlags{"secret"}
+	defer func() { sets, renames, deletes = nil, nil, nil }()
+	rw, err := parseRewrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &relay{
+		em:      bus.Emitter(),
+		names:   cli.NameFilter{Names: cli.ArrayFlags{"Test::*"}, Excludes: cli.ArrayFlags{"Test::Ignored"}},
+		rewrite: rw,
+		marker:  "RelayedBy",
+		id:      "b",
+	}
+	r.forward(encode(t, `Test::A { uint16 SiteID = 1; old = 3; secret = x; RelayedBy = a; }`))
+	r.forward(encode(t, `Test::A { RelayedBy = "a,b"; }`))
+	r.forward(encode(t, `Test::Ignored {}`))
+	r.forward(encode(t, `Other::A {}`))
+	r.forward([]byte{9, 'x'})
+
+	bus.ExpectEvent(t, "Test::A", map[string]interface{}{
+		"SiteID":    uint16(2),
+		"new":       int64(3),
+		"RelayedBy": "a,b",
+	})
+	if lwe := bus.NextEvent(); lwe != nil {
+		t.Fatalf("got an unexpected event %v", lwe)
+	}
+
+	want := relayMetrics{EventsReceived: 5, EventsForwarded: 1, EventsFiltered: 2, EventsLooped: 1, EventsInvalid: 1}
+	if m := r.snapshot(); m != want {
+		t.Fatalf("got the metrics %+v, want %+v", m, want)
+	}
+}
+
+func TestRelayRaw(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	r := &relay{em: bus.Emitter(), rewrite: rewrite{set: lwes.NewLwesEvent("")}, limiter: newLimiter(1, 2)}
+	for i := 0; i < 3; i++ {
+		r.forward(encode(t, `Test::A { uint16 i = 1; }`))
+	}
+	bus.ExpectEvent(t, "Test::A", map[string]interface{}{"i": uint16(1)})
+	bus.ExpectEvent(t, "Test::A", map[string]interface{}{"i": uint16(1)})
+	if m := r.snapshot(); m.EventsForwarded != 2 || m.EventsRateLimited != 1 {
+		t.Fatalf("got the metrics %+v, want 2 events forwarded and 1 rate limited", m)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(10, 1)
+	now := time.Unix(1000, 0)
+	if !l.allow(now) || l.allow(now) {
+		t.Fatalf("expected a burst of 1")
+	}
+	if l.allow(now.Add(50*time.Millisecond)) || !l.allow(now.Add(100*time.Millisecond)) {
+		t.Fatalf("expected a token every 100ms")
+	}
+}
@@ -2,12 +2,14 @@ package lwes
 
 import (
 	"encoding"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/net/ipv4"
 )
@@ -18,34 +20,115 @@ var (
 	defaultRcvBuf = 256 * 1024 * 1024
 )
 
+// the transport schemes accepted by ParseFromString
+const (
+	schemeMulticast = "lwes"      // lwes:<iface>:<ip>:<port>:<ttl>, multicast (or plain) UDP
+	schemeUDP       = "lwes-udp"  // lwes-udp:<ip>:<port>, unicast UDP
+	schemeTCP       = "lwes-tcp"  // lwes-tcp:<host>:<port>, length-prefixed TCP
+	schemeUnix      = "lwes-unix" // lwes-unix:<path>, unix datagram socket
+)
+
+// ErrNoDestination is returned by Emit while no destination is
+// connected, like the hostnames not resolved yet
+var ErrNoDestination = errors.New("no lwes destination to emit to")
+
 type conn struct {
-	*net.UDPConn
+	Transport
+
+	dest *serverConfig // the destination by hostname, resolved periodically
+	addr *net.UDPAddr  // the address the hostname is currently resolved to
 }
 
 type Emitter struct {
 	mutex sync.RWMutex
 	conns []*conn
+
+	resolve chan struct{} // asks the resolver to run now
+	done    chan struct{}
+
+	maxSize  int // the max event size all the transports accept
+	oversize OversizePolicy
+	splitKey string
+
+	sink    sinkRef
+	metrics EmitterMetrics // updated atomically
+}
+
+// EmitterMetrics counts the events of an Emitter since it was opened
+type EmitterMetrics struct {
+	EventsEmitted   int64 `mondemand_stat:"events_emitted"`
+	BytesEmitted    int64 `mondemand_stat:"bytes_emitted"`
+	EventsTooLarge  int64 `mondemand_stat:"events_too_large"`
+	EventsTruncated int64 `mondemand_stat:"events_truncated"`
+	EventsSplit     int64 `mondemand_stat:"events_split"`
+	WriteErrors     int64 `mondemand_stat:"write_errors"`
+	EventsDropped   int64 `mondemand_stat:"events_dropped"` // by the TCP buffers, not pushed to the sink
+}
+
+type serverConfig struct {
+	scheme   string
+	iface    string
+	addrport string
+	sndbuf   int
+	ttl      uint8
 }
 
 type EmitterConfig struct {
-	Servers []struct {
-		iface    string
-		addrport string
-		sndbuf   int
-		ttl      uint8
-	}
-	msend int
+	Servers []serverConfig
+	msend   int
+
+	// TCPBufferSize is the max bytes of events kept in memory for each
+	// lwes-tcp transport while it is disconnected; 0 means the default
+	TCPBufferSize int
+
+	// Oversize decides what to do with an event exceeding the max
+	// size of the transports: MAX_MSG_SIZE for UDP and MAX_PACKET_SIZE
+	// for TCP, the default of the TCP listener; the default is to
+	// reject it
+	Oversize OversizePolicy
+	// SplitKey is the count key of the attributes spread by
+	// OversizeSplit, like "ctxt_num"; "" means "num"
+	SplitKey string
+
+	// ResolveInterval enables resolving the UDP destinations given by
+	// hostname again every interval and after write errors; with it
+	// a hostname failing to resolve in Open is kept and retried later
+	ResolveInterval time.Duration
 }
 
-// each transport param is lwes::ip:port:<ttl> form
+// each transport param is one of the forms:
+//
+//	lwes:<iface>:<ip>:<port>[:<ttl>]  multicast UDP
+//	lwes-udp:<ip>:<port>              unicast UDP
+//	lwes-tcp:<host>:<port>            TCP with length-prefixed events
+//	lwes-unix:<path>                  unix datagram socket
 func (sc *EmitterConfig) ParseFromString(param string) (err error) {
 	words := strings.Split(param, ":")
+	switch words[0] {
+	case schemeMulticast:
+	case schemeUnix:
+		// the path may contain colons
+		path := strings.TrimPrefix(param, schemeUnix+":")
+		if path == "" {
+			return fmt.Errorf("needs format %s:<path>, but got %q", schemeUnix, param)
+		}
+		sc.Servers = append(sc.Servers, serverConfig{scheme: schemeUnix, addrport: path})
+		return nil
+	case schemeUDP, schemeTCP:
+		if len(words) != 3 || words[1] == "" || words[2] == "" {
+			return fmt.Errorf("needs format %s:<host>:<port>, but got %q", words[0], param)
+		}
+		sc.Servers = append(sc.Servers, serverConfig{
+			scheme: words[0], addrport: words[1] + ":" + words[2],
+		})
+		return nil
+	default:
+		return fmt.Errorf("only lwes, lwes-udp, lwes-tcp and lwes-unix are supported, but got %q", param)
+	}
+
 	if !(4 <= len(words) && len(words) <= 5) {
 		return fmt.Errorf("needs format lwes:<iface>:ip:port, but got %q", param)
 	}
-	if words[0] != "lwes" {
-		return fmt.Errorf("lwes is the only supported, but got %q", param)
-	}
 	iface := ""
 	if words[1] != "" {
 		iface = words[1]
@@ -54,109 +137,346 @@ func (sc *EmitterConfig) ParseFromString(param string) (err error) {
 	port := words[3]
 
 	var ttl uint64
-	if len(words) == 5 && words[5] != "" {
-		ttl, err = strconv.ParseUint(words[5], 10, 8)
+	if len(words) == 5 && words[4] != "" {
+		ttl, err = strconv.ParseUint(words[4], 10, 8)
 		if err != nil {
 			return fmt.Errorf("ttl is not valid: %q, %v", param, err)
 		}
 	}
 
-	sc.Servers = append(sc.Servers,
-		struct {
-			iface    string
-			addrport string
-			sndbuf   int
-			ttl      uint8
-		}{
-			iface: iface, addrport: ip + ":" + port, ttl: uint8(ttl),
-		})
+	sc.Servers = append(sc.Servers, serverConfig{
+		scheme: schemeMulticast, iface: iface, addrport: ip + ":" + port, ttl: uint8(ttl),
+	})
 
 	return nil
 }
 
-// each transport is lwes::ip:port:<ttl> form
+// each transport is one of the forms accepted by ParseFromString
 func Open(cfg EmitterConfig) *Emitter {
 	// lwes:<iface>:<ip>:<port>:<ttl>
 
 	conns := make([]*conn, 0, len(cfg.Servers))
-	for _, scfg := range cfg.Servers {
+	for i := range cfg.Servers {
+		// a copy, not to share the caller's config with the resolver
+		scfg := new(serverConfig)
+		*scfg = cfg.Servers[i]
+		if scfg.scheme == schemeTCP {
+			conns = append(conns, &conn{Transport: dialTCP(scfg.addrport, cfg.TCPBufferSize)})
+			continue
+		}
+		if scfg.scheme == schemeUnix {
+			conns = append(conns, &conn{Transport: newUnixTransport(scfg.addrport, scfg.sndbuf)})
+			continue
+		}
+
+		// keep the destinations by hostname to be resolved again later
+		var dest *serverConfig
+		if host, _, _ := net.SplitHostPort(scfg.addrport); cfg.ResolveInterval > 0 && net.ParseIP(host) == nil {
+			dest = scfg
+		}
+
 		addr, err := net.ResolveUDPAddr("udp", scfg.addrport)
 		if err != nil {
+			if dest != nil {
+				log.Printf("failed to resolve %q:%v:%#v, retry in %s\n", scfg.addrport, err, err, cfg.ResolveInterval)
+				conns = append(conns, &conn{dest: dest})
+				continue
+			}
 			log.Printf("failed to resolve %q:%v:%#v, ignored\n", scfg, err, err)
 			continue
 		}
 
-		c, err := net.DialUDP("udp", nil, addr)
-		// conn, err := net.ListenUDP("udp", nil)
+		c, err := dialUDP(scfg, addr)
 		if err != nil {
-			log.Printf("failed to dail %q:%v:%#v, ignored\n", addr, err, err)
 			continue
 		}
+		conns = append(conns, &conn{Transport: udpTransport{c}, dest: dest, addr: addr})
+	}
+
+	if len(conns) == 0 {
+		log.Println("no connections made.")
+		return nil
+	}
+
+	em := newEmitter(conns)
+	em.oversize = cfg.Oversize
+	em.splitKey = cfg.SplitKey
+	if cfg.ResolveInterval > 0 {
+		em.resolve = make(chan struct{}, 1)
+		em.done = make(chan struct{})
+		go em.resolver(cfg.ResolveInterval)
+	}
+	return em
+}
+
+// NewEmitter returns an emitter sending the events to all the transports;
+// Open is the constructor over the default UDP and TCP transports
+func NewEmitter(transports ...Transport) *Emitter {
+	conns := make([]*conn, 0, len(transports))
+	for _, t := range transports {
+		conns = append(conns, &conn{Transport: t})
+	}
+	return newEmitter(conns)
+}
+
+func newEmitter(conns []*conn) *Emitter {
+	em := &Emitter{conns: conns, maxSize: MAX_FRAME_SIZE}
+	for _, c := range conns {
+		if c.Transport == nil {
+			// an unresolved UDP destination
+			em.maxSize = min(em.maxSize, MAX_MSG_SIZE)
+		} else {
+			em.maxSize = min(em.maxSize, c.MaxEventSize())
+		}
+	}
+	return em
+}
+
+// SetOversizePolicy sets what to do with an event exceeding the max
+// size of the transports, like EmitterConfig.Oversize
+func (em *Emitter) SetOversizePolicy(policy OversizePolicy) {
+	em.oversize = policy
+}
+
+// SetSplitKey sets the count key of the attributes spread by
+// OversizeSplit, like EmitterConfig.SplitKey
+func (em *Emitter) SetSplitKey(key string) {
+	em.splitKey = key
+}
+
+// dialUDP connects to the resolved addr, and applies the multicast
+// settings of the transport if the addr is a multicast group
+func dialUDP(scfg *serverConfig, addr *net.UDPAddr) (*net.UDPConn, error) {
+	c, err := net.DialUDP("udp", nil, addr)
+	// conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		log.Printf("failed to dail %q:%v:%#v, ignored\n", addr, err, err)
+		return nil, err
+	}
+
+	var writebuffer int = defaultSndBuf
+	if scfg.sndbuf != 0 {
+		writebuffer = scfg.sndbuf
+	}
+	if err = c.SetWriteBuffer(writebuffer); err != nil {
+		log.Printf("unable to set send buffer size: err %v:%#v\n", err, err)
+	}
+
+	// multicast settings are meaningless for unicast destinations
+	if scfg.scheme == schemeUDP || !addr.IP.IsMulticast() {
+		return c, nil
+	}
 
-		var writebuffer int = defaultSndBuf
-		if scfg.sndbuf != 0 {
-			writebuffer = scfg.sndbuf
+	p := ipv4.NewPacketConn(c)
+	if scfg.iface != "" {
+		intf, err := net.InterfaceByName(scfg.iface)
+		if err != nil {
+			log.Printf("unable to get intf: %q err %v:%#v\n", scfg.iface, err, err)
+			c.Close()
+			return nil, err
 		}
-		if err = c.SetWriteBuffer(writebuffer); err != nil {
-			log.Printf("unable to set send buffer size: err %v:%#v\n", err, err)
+		p.SetMulticastInterface(intf)
+	}
+
+	var ttl int = defaultTTL
+	if scfg.ttl != 0 {
+		ttl = int(scfg.ttl)
+	}
+	p.SetMulticastTTL(ttl)
+	p.SetMulticastLoopback(false)
+
+	return c, nil
+}
+
+// resolver resolves the hostname destinations every interval, or
+// sooner after a write error, and swaps the connections of the ones
+// which moved to a new address
+func (em *Emitter) resolver(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-em.done:
+			return
+		case <-ticker.C:
+		case <-em.resolve:
 		}
 
-		p := ipv4.NewPacketConn(c)
-		if scfg.iface != "" {
-			intf, err := net.InterfaceByName(scfg.iface)
-			if err != nil {
-				log.Printf("unable to get intf: %q err %v:%#v\n", scfg.iface, err, err)
-				continue
+		em.mutex.RLock()
+		conns := em.conns
+		em.mutex.RUnlock()
+
+		for _, c := range conns {
+			if c.dest != nil {
+				em.reresolve(c)
 			}
-			p.SetMulticastInterface(intf)
 		}
+	}
+}
 
-		var ttl int = defaultTTL
-		if scfg.ttl != 0 {
-			ttl = int(scfg.ttl)
-		}
-		p.SetMulticastTTL(ttl)
-		p.SetMulticastLoopback(false)
+func (em *Emitter) reresolve(c *conn) {
+	addr, err := net.ResolveUDPAddr("udp", c.dest.addrport)
+	if err != nil {
+		log.Printf("failed to resolve %q:%v:%#v, keeping %v\n", c.dest.addrport, err, err, c.addr)
+		return
+	}
+	if c.addr != nil && c.addr.IP.Equal(addr.IP) && c.addr.Port == addr.Port {
+		return
+	}
 
-		conns = append(conns, &conn{c})
+	nc, err := dialUDP(c.dest, addr)
+	if err != nil {
+		return
 	}
+	log.Printf("%q moved from %v to %v\n", c.dest.addrport, c.addr, addr)
 
-	if len(conns) == 0 {
-		log.Println("no connections made.")
-		return nil
+	// the writers hold the read lock, so no event is written to the
+	// old connection after it's swapped out
+	em.mutex.Lock()
+	if em.conns == nil {
+		// closed while resolving
+		em.mutex.Unlock()
+		nc.Close()
+		return
 	}
+	old := c.Transport
+	c.Transport, c.addr = udpTransport{nc}, addr
+	em.mutex.Unlock()
 
-	return &Emitter{conns: conns}
+	if old != nil {
+		old.Close()
+	}
 }
 
+// resolveSoon asks the resolver to resolve the destinations again
+// without waiting for the next interval
+func (em *Emitter) resolveSoon() {
+	select {
+	case em.resolve <- struct{}{}:
+	default:
+	}
+}
+
+// Emit sends the event to all the destinations; it fails with the last
+// Write error of the transports if none of them was written to, or with
+// ErrNoDestination if none is connected. The lwes-tcp transport buffers
+// the events while reconnecting, so they are not failed
 func (em *Emitter) Emit(lwe encoding.BinaryMarshaler) error {
 	buf, err := Marshal(lwe)
 	if err != nil {
-		return nil
+		return err
+	}
+	if len(buf) <= em.maxSize {
+		return em.write(buf)
 	}
 
+	event, ok := lwe.(*LwesEvent)
+	if !ok {
+		em.sink.count(&em.metrics.EventsTooLarge, "events_too_large", 1)
+		return &EventTooLargeError{Size: len(buf), Limit: em.maxSize}
+	}
+
+	var events []*LwesEvent
+	switch em.oversize {
+	case OversizeTruncate:
+		event, err = event.Truncate(em.maxSize)
+		events = []*LwesEvent{event}
+	case OversizeSplit:
+		key := em.splitKey
+		if key == "" {
+			key = "num"
+		}
+		events, err = event.Split(key, em.maxSize)
+	default:
+		err = &EventTooLargeError{Name: event.Name, Size: len(buf), Limit: em.maxSize}
+	}
+	if err != nil {
+		em.sink.count(&em.metrics.EventsTooLarge, "events_too_large", 1)
+		return err
+	}
+	if em.oversize == OversizeTruncate {
+		em.sink.count(&em.metrics.EventsTruncated, "events_truncated", 1)
+	} else {
+		em.sink.count(&em.metrics.EventsSplit, "events_split", 1)
+	}
+
+	for _, event := range events {
+		if buf, err = Marshal(event); err != nil {
+			return err
+		}
+		if err = em.write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write the event to all the destinations; it's emitted if at least
+// one of the writes succeeded, else the last error is returned
+func (em *Emitter) write(buf []byte) error {
 	em.mutex.RLock()
 	defer em.mutex.RUnlock()
 
+	err := ErrNoDestination
+	written := false
 	for _, conn := range em.conns {
+		if conn.Transport == nil {
+			// the destination is not resolved yet
+			continue
+		}
 		// n, err := conn.WriteToUDP(buf, conn.UDPAddr)
-		n, err := conn.Write(buf)
-		if err != nil {
-			log.Printf("failed to write to conn, err %v:%#v\n", err, err)
+		if _, werr := conn.Write(buf); werr != nil {
+			em.sink.count(&em.metrics.WriteErrors, "write_errors", 1)
+			log.Printf("failed to write to conn, err %v:%#v\n", werr, werr)
+			if conn.dest != nil {
+				em.resolveSoon()
+			}
+			err = werr
+			continue
 		}
-		_ = n
+		written = true
 		// log.Printf("written %d:%d bytes.\n", n, len(buf))
 	}
-
+	if !written {
+		return err
+	}
+	em.sink.count(&em.metrics.EventsEmitted, "events_emitted", 1)
+	em.sink.count(&em.metrics.BytesEmitted, "bytes_emitted", int64(len(buf)))
 	return nil
 }
 
+// SetMetricsSink pushes the updates of the metrics to the sink
+func (em *Emitter) SetMetricsSink(sink MetricsSink) {
+	em.sink.use(sink)
+}
+
+// Metrics returns a snapshot of the metrics of the emitter
+func (em *Emitter) Metrics() EmitterMetrics {
+	m := snapshotMetrics(&em.metrics)
+
+	em.mutex.RLock()
+	defer em.mutex.RUnlock()
+	for _, conn := range em.conns {
+		if c, ok := conn.Transport.(*tcpConn); ok {
+			m.EventsDropped += c.droppedEvents()
+		}
+	}
+	return m
+}
+
 func (em *Emitter) Close() {
 	em.mutex.Lock()
 	defer em.mutex.Unlock()
 
+	if em.done != nil && em.conns != nil {
+		close(em.done)
+	}
+
 	for _, conn := range em.conns {
-		conn.Close()
+		if conn.Transport != nil {
+			conn.Close()
+		}
 	}
 	em.conns = nil
 }
@@ -0,0 +1,213 @@
+package lwes
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseFromString(t *testing.T) {
+	tests := []struct {
+		param string
+		want  serverConfig
+	}{
+		{"lwes::239.5.1.1:10201", serverConfig{scheme: schemeMulticast, addrport: "239.5.1.1:10201"}},
+		{"lwes:eth0:239.5.1.1:10201:5", serverConfig{scheme: schemeMulticast, iface: "eth0", addrport: "239.5.1.1:10201", ttl: 5}},
+		{"lwes-udp:10.1.2.3:10201", serverConfig{scheme: schemeUDP, addrport: "10.1.2.3:10201"}},
+		{"lwes-tcp:collector.local:10201", serverConfig{scheme: schemeTCP, addrport: "collector.local:10201"}},
+		{"lwes-unix:/run/lwes.sock", serverConfig{scheme: schemeUnix, addrport: "/run/lwes.sock"}},
+	}
+	for _, tt := range tests {
+		var cfg EmitterConfig
+		if err := cfg.ParseFromString(tt.param); err != nil {
+			t.Fatalf("%q: unexpected error %v", tt.param, err)
+		}
+		if len(cfg.Servers) != 1 || cfg.Servers[0] != tt.want {
+			t.Fatalf("%q: got %+v, want %+v", tt.param, cfg.Servers, tt.want)
+		}
+	}
+
+	for _, param := range []string{"udp:1.2.3.4:10", "lwes-udp:1.2.3.4", "lwes:1.2.3.4:10", "lwes::1.2.3.4:10:ttl", "lwes-unix:"} {
+		var cfg EmitterConfig
+		if err := cfg.ParseFromString(param); err == nil {
+			t.Fatalf("%q: expected an error", param)
+		}
+	}
+}
+
+func TestTCPEmitter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var cfg EmitterConfig
+	if err := cfg.ParseFromString("lwes-tcp:" + ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	defer em.Close()
+
+	for i := 0; i < 3; i++ {
+		lwe := NewLwesEvent("Test::Event")
+		lwe.Set("seq", int64(i))
+		if err := em.Emit(lwe); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for i := 0; i < 3; i++ {
+		n, err := readFrameHeader(c, MAX_FRAME_SIZE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(c, buf); err != nil {
+			t.Fatal(err)
+		}
+		lwe := new(LwesEvent)
+		if err := lwe.UnmarshalBinary(buf); err != nil {
+			t.Fatal(err)
+		}
+		if lwe.Name != "Test::Event" || lwe.Attrs["seq"] != int64(i) {
+			t.Fatalf("unexpected event %d: %v", i, lwe)
+		}
+	}
+}
+
+func TestTCPEmitterBufferLimit(t *testing.T) {
+	// nothing is listening there, so all writes are buffered
+	c := &tcpConn{addrport: "127.0.0.1:1", maxPending: 3 * (frameHeaderSize + 4)}
+	for i := 0; i < 5; i++ {
+		if _, err := c.Write([]byte("abcd")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.pending) != 3 || c.dropped != 2 {
+		t.Fatalf("got %d pending and %d dropped, want 3 and 2", len(c.pending), c.dropped)
+	}
+}
+
+func TestEmitterReresolve(t *testing.T) {
+	addr, err := net.ResolveUDPAddr("udp", "localhost:0")
+	if err != nil {
+		t.Skip("localhost does not resolve:", err)
+	}
+	ln, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.LocalAddr().String())
+
+	cfg := EmitterConfig{ResolveInterval: time.Hour}
+	if err := cfg.ParseFromString("lwes-udp:localhost:" + port); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	defer em.Close()
+
+	c := em.conns[0]
+	if c.dest == nil || c.addr == nil {
+		t.Fatalf("expected the hostname destination kept for resolving, got %+v", c)
+	}
+
+	// pretend the hostname was resolved to a different address before
+	old := c.Transport
+	c.addr = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1}
+	em.reresolve(c)
+	if c.Transport == old {
+		t.Fatal("expected the connection swapped after the address changed")
+	}
+
+	lwe := NewLwesEvent("Test::Event")
+	lwe.Set("seq", int64(1))
+	em.Emit(lwe)
+
+	buf := make([]byte, MAX_PACKET_SIZE)
+	ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := ln.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(LwesEvent)
+	if err := got.UnmarshalBinary(buf[:n]); err != nil || got.Attrs["seq"] != int64(1) {
+		t.Fatalf("unexpected event %v, err %v", got, err)
+	}
+}
+
+func TestEmitterKeepsUnresolvedHostname(t *testing.T) {
+	cfg := EmitterConfig{ResolveInterval: time.Hour}
+	if err := cfg.ParseFromString("lwes-udp:no-such-host.invalid:10201"); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	if em == nil {
+		t.Fatal("expected the unresolved hostname kept")
+	}
+	defer em.Close()
+
+	// not emitted until it's resolved
+	if err := em.Emit(NewLwesEvent("Test::Event")); err != ErrNoDestination {
+		t.Fatalf("expected ErrNoDestination while not resolved, got %v", err)
+	}
+	if m := em.Metrics(); m.EventsEmitted != 0 {
+		t.Fatalf("expected no event emitted, got %d", m.EventsEmitted)
+	}
+}
+
+func TestEmitterCopiesConfig(t *testing.T) {
+	cfg := EmitterConfig{ResolveInterval: time.Hour}
+	if err := cfg.ParseFromString("lwes-udp:no-such-host.invalid:10201"); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	if em == nil {
+		t.Fatal("expected the unresolved hostname kept")
+	}
+	defer em.Close()
+
+	cfg.Servers[0].addrport = "other-host.invalid:10202"
+	if got := em.conns[0].dest.addrport; got != "no-such-host.invalid:10201" {
+		t.Fatalf("expected the destination kept after the config changed, got %q", got)
+	}
+}
+
+// failingTransport fails all the writes
+type failingTransport struct{}
+
+func (failingTransport) Write(p []byte) (int, error) { return 0, errors.New("write failed") }
+func (failingTransport) Close() error                { return nil }
+func (failingTransport) MaxEventSize() int           { return MAX_MSG_SIZE }
+
+func TestEmitterWriteErrors(t *testing.T) {
+	tr, src := NewPipe(10)
+	defer src.Close()
+
+	// emitted if one of the writes succeeds
+	em := NewEmitter(failingTransport{}, tr)
+	if err := em.Emit(NewLwesEvent("Test::Event")); err != nil {
+		t.Fatal(err)
+	}
+	if m := em.Metrics(); m.EventsEmitted != 1 || m.WriteErrors != 1 {
+		t.Fatalf("got %d emitted and %d write errors, want 1 and 1", m.EventsEmitted, m.WriteErrors)
+	}
+
+	em = NewEmitter(failingTransport{}, failingTransport{})
+	if err := em.Emit(NewLwesEvent("Test::Event")); err == nil {
+		t.Fatal("expected an error when all the writes failed")
+	}
+	if m := em.Metrics(); m.EventsEmitted != 0 || m.BytesEmitted != 0 || m.WriteErrors != 2 {
+		t.Fatalf("got %d emitted, %d bytes and %d write errors, want 0, 0 and 2", m.EventsEmitted, m.BytesEmitted, m.WriteErrors)
+	}
+}
@@ -0,0 +1,111 @@
+package lwes
+
+// MetaEventInfo is the name of the ESF event of the attrs of all events
+const MetaEventInfo = "MetaEventInfo"
+
+// ESFAttr is an attribute of an event of an ESF
+type ESFAttr struct {
+	Type    string // the type name, like "uint16"
+	Key     string
+	Default interface{} // the value after '=', or nil
+}
+
+// ESFEvent is an event of an ESF, with its attrs in order
+type ESFEvent struct {
+	Name  string
+	Attrs []ESFAttr
+}
+
+// ParseESF parses an event specification file of the C and Java
+// libraries, with comments from '#' to the end of the line:
+//
+//	MetaEventInfo
+//	{
+//		ip_addr SenderIP;
+//		uint16 SenderPort;
+//		int64 ReceiptTime;
+//	}
+//
+//	MonDemand::LogMsg
+//	{
+//		required string prog_id;
+//		uint16 num = 0;
+//	}
+//
+// The "required", "optional" and "nullable" qualifiers are accepted and
+// ignored; the arrays are not supported.
+func ParseESF(text string) ([]ESFEvent, error) {
+	p := textParser{text: text, line: 1}
+	var events []ESFEvent
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return events, nil
+		}
+		ev, err := p.parseESFEvent()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+}
+
+func (p *textParser) parseESFEvent() (ESFEvent, error) {
+	name, err := p.word("an event name")
+	if err != nil {
+		return ESFEvent{}, err
+	}
+	ev := ESFEvent{Name: name}
+	if err := p.expect('{'); err != nil {
+		return ESFEvent{}, err
+	}
+
+	keys := make(map[string]bool)
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			return ev, nil
+		}
+
+		typ, err := p.word("a type")
+		for err == nil && (typ == "required" || typ == "optional" || typ == "nullable") {
+			typ, err = p.word("a type")
+		}
+		if err != nil {
+			return ESFEvent{}, err
+		}
+		if !knownType(typ) {
+			return ESFEvent{}, p.errorf("unknown type %q", typ)
+		}
+		key, err := p.word("a key")
+		if err != nil {
+			return ESFEvent{}, err
+		}
+		if keys[key] {
+			return ESFEvent{}, p.errorf("duplicated attr %q", key)
+		}
+		keys[key] = true
+		attr := ESFAttr{Type: typ, Key: key}
+
+		p.skipSpace()
+		switch p.peek() {
+		case '[':
+			return ESFEvent{}, p.errorf("attr %q: arrays are not supported", key)
+		case '=':
+			p.pos++
+			s, _, err := p.value()
+			if err != nil {
+				return ESFEvent{}, err
+			}
+			if attr.Default, err = parseValue(typ, s); err != nil {
+				return ESFEvent{}, p.errorf("attr %q: %v", key, err)
+			}
+		}
+		ev.Attrs = append(ev.Attrs, attr)
+
+		if err := p.expect(';'); err != nil {
+			return ESFEvent{}, err
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package lwes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseESF(t *testing.T) {
+	events, err := ParseESF(`
+# the attrs of all events
+MetaEventInfo
+{
+	ip_addr SenderIP;   # set by the listener
+	int64 ReceiptTime;
+}
+
+MonDemand::LogMsg
+{
+	required string prog_id;
+	nullable uint16 num = 3;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ESFEvent{
+		{Name: MetaEventInfo, Attrs: []ESFAttr{{Type: "ip_addr", Key: "SenderIP"}, {Type: "int64", Key: "ReceiptTime"}}},
+		{Name: "MonDemand::LogMsg", Attrs: []ESFAttr{{Type: "string", Key: "prog_id"}, {Type: "uint16", Key: "num", Default: uint16(3)}}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got %+v, want %+v", events, want)
+	}
+
+	for _, tc := range []struct {
+		text string
+		err  string
+	}{
+		{"E {\n int128 a; }", "line 2: unknown type \"int128\""},
+		{"E { int32 a[4]; }", "arrays are not supported"},
+		{"E { int32 a; int32 a; }", "duplicated attr \"a\""},
+		{"E { uint16 a = -1; }", "attr \"a\""},
+		{"E { int32 a }", "expected ';'"},
+	} {
+		_, err := ParseESF(tc.text)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("parsing %q: got %v, want an error of %q", tc.text, err, tc.err)
+		}
+	}
+}
@@ -212,3 +212,18 @@ func ExampleNewLwesEvent() {
 	// 	ctxt_v2 = 28;
 	// }
 }
+
+// Example skipping the events of the names not wanted without decoding
+// their attrs
+func ExamplePeekName() {
+	data, _ := lwes.Marshal(lwes.NewLwesEvent("MonDemand::PerfMsg"))
+
+	name, err := lwes.PeekName(data)
+	fmt.Println(name, err)
+
+	_, err = lwes.PeekName(data[:5])
+	fmt.Println(err)
+	// Output:
+	// MonDemand::PerfMsg <nil>
+	// Unexpected end of msg with remaining: 4 bytes from total len: 5
+}
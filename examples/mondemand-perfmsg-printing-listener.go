@@ -6,15 +6,14 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"reflect"
 	"runtime"
 	// "sync"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/lwes/lwes-go"
 	"github.com/lwes/lwes-go/examples/pkg/multicast_group"
+	"github.com/lwes/lwes-go/mondemand"
 )
 
 var (
@@ -51,46 +50,22 @@ func main() {
 		log.Fatalln("failed to start server")
 	}
 
-	sc := NewStatsClient("go-lwes-data-pipeline", 60*time.Second, map[string]interface{}{
-		"ip":   "239.5.1.1",
-		"port": uint16(10201),
-	})
+	var cfg lwes.EmitterConfig
+	cfg.ParseFromString("lwes::239.5.1.1:10201")
+	em := lwes.Open(cfg)
+	if em == nil {
+		log.Fatalln("failed to open lwes channel")
+	}
+	sc := mondemand.NewClient("go-lwes-data-pipeline", 60*time.Second, em)
 	host, _ := os.Hostname()
 	sc.AddContext("host", host)
 
+	report := mondemand.MetricsReporter(sc)
 	server.EnableMetricsReport(
 		5*time.Second,
-		func(_ string, v interface{}) {
-			// get a copy of a struct containing metrics
-			// TODO: need a cache for same structures, like "encoding/json"
-			t := reflect.TypeOf(v)
-			if t.Kind() != reflect.Struct {
-				// log.Println("accept a struct with int64 only")
-				return
-			}
-			s := reflect.ValueOf(v)
-			for i := 0; i < t.NumField(); i++ {
-				tf := t.Field(i)
-				vf := s.Field(i)
-				/* fmt.Printf("%d: %s<%v,%v> %q %s = %v\n", i, tf.Name,
-				   tf.Type.Kind(), tf.Type.Kind() == reflect.Int64,
-				   tf.Tag.Get("mondemand_stat"), vf.Type(), vf.Interface()) */
-				if tag := tf.Tag.Get("mondemand_stat"); tag != "" && tf.Type.Kind() == reflect.Int64 {
-					words := strings.SplitN(tag, ",", 2)
-					name := words[0]
-					tag_m := "counter"
-					if len(words) == 2 {
-						tag_m = words[1]
-					}
-					switch tag_m {
-					case "counter":
-						sc.SetCounter(name, vf.Interface().(int64))
-					case "gauge":
-						sc.SetGauge(name, vf.Interface().(int64))
-					}
-				}
-			}
-			fmt.Println("reporting metrics", reflect.ValueOf(v))
+		func(name string, v interface{}) {
+			report(name, v)
+			fmt.Println("reporting metrics", name, v)
 			sc.Increment("metrics_reported", 1)
 		},
 	)
@@ -117,9 +92,12 @@ func main() {
 		}
 
 		// printLwesEvent(lwe)
-		msg := DecodePerfMsg(lwe)
+		msg, err := mondemand.DecodePerfMsg(lwe)
+		if err != nil {
+			continue // not a valid PerfMsg
+		}
 		if !noop {
-			msg.Print()
+			printPerfMsg(msg)
 		}
 		sc.Increment("msgs_printed", 1)
 	}
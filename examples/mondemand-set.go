@@ -1,19 +1,29 @@
 package main
 
 import (
+	"log"
 	"os"
 	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/mondemand"
 )
 
 func main() {
-	sc := NewStatsClient("mondemand-performance", 60*time.Second, map[string]interface{}{
-		"ip":   "239.5.1.1",
-		"port": uint16(10201),
-	})
+	var cfg lwes.EmitterConfig
+	cfg.ParseFromString("lwes::239.5.1.1:10201")
+	em := lwes.Open(cfg)
+	if em == nil {
+		log.Fatal("failed to open lwes channel.\n")
+	}
+	defer em.Close()
+
+	sc := mondemand.NewClient("mondemand-performance", 60*time.Second, em)
+	defer sc.Close()
 	host, _ := os.Hostname()
 
 	sc.AddContext("host", host)
-	sc.Set("text_to_text_seconds", 53)
+	sc.SetGauge("text_to_text_seconds", 53)
 	// sc.Flush()
 
 	tc := time.Tick(30 * time.Second)
@@ -22,7 +32,7 @@ func main() {
 	for {
 		select {
 		case <-tc:
-			sc.Set("text_to_text_seconds", 23)
+			sc.SetGauge("text_to_text_seconds", 23)
 		case <-tc2:
 			sc.Increment("text_to_text_done", 1)
 		case <-t2:
@@ -9,6 +9,7 @@ import (
 	// "time"
 
 	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/mondemand"
 )
 
 var (
@@ -39,7 +40,7 @@ func main() {
 	flag.Parse()
 	// fmt.Println(transports)
 
-	st := NewStatsMsg(prog_id)
+	st := mondemand.NewStatsMsg(prog_id)
 
 	for _, ctx := range context {
 		words := strings.SplitN(ctx, ":", 2)
@@ -68,19 +69,23 @@ func main() {
 	}
 
 	if len(transports) == 0 {
-		transports = append(transports, "239.5.1.1:10201")
+		transports = append(transports, "lwes::239.5.1.1:10201")
 	}
 
-	validated := make([]map[string]interface{}, 0, len(transports))
+	var cfg lwes.EmitterConfig
 	for _, trans := range transports {
-		if v := validate_transport(trans); v != nil {
-			validated = append(validated, v)
+		if trans == "stderr" {
+			// TODO: support stderr
+			continue
+		}
+		if err := cfg.ParseFromString(trans); err != nil {
+			fmt.Printf("invalid transport: %v\n", err)
 		}
 	}
 
-	fmt.Println(validated)
+	fmt.Println(cfg.Servers)
 
-	em := lwes.Open(validated...)
+	em := lwes.Open(cfg)
 	if em == nil {
 		log.Fatal("failed to open lwes channel.\n")
 	}
@@ -88,37 +93,3 @@ func main() {
 	em.Emit(st.ToLwes())
 	em.Close()
 }
-
-func validate_transport(str string) map[string]interface{} {
-	words := strings.Split(str, ":")
-	if len(words) == 1 && words[0] == "stderr" {
-		// TODO: support stderr
-		return nil
-	}
-	if !(4 <= len(words) && len(words) <= 5) {
-		// invalid
-		return nil
-	}
-	if words[0] != "lwes" {
-		return nil
-	}
-
-	// TODO: strconv to check port and ttl are in valid ranges
-	port, err := strconv.ParseUint(words[3], 10, 16)
-	if err != nil {
-		return nil
-	}
-	v := map[string]interface{}{
-		"iface": words[1],
-		"ip":    words[2],
-		"port":  uint16(port),
-	}
-	if len(words) == 5 {
-		ttl, err := strconv.ParseUint(words[4], 10, 8)
-		if err != nil {
-			return nil
-		}
-		v["ttl"] = uint8(ttl)
-	}
-	return v
-}
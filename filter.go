@@ -0,0 +1,570 @@
+package lwes
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a compiled filter expression on the events, like
+//
+//	name =~ "MonDemand::.*" && caller_label == "broker" && num > 0
+//
+// "name" is the event name, and the other identifiers are the keys of the
+// attrs; attr("name") is the attr of a key which is not an identifier or
+// is "name". The comparisons are ==, !=, <, <=, >, >= of the numbers,
+// the strings and the booleans, with the ip addresses as strings, and
+// =~, !~ of a string with a regexp matching the whole of it. They are
+// false with a missing attr or values of different kinds. A bare attr
+// is true if it's the boolean true. && binds before ||, and ! negates.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// a value of a comparison from the name only
+type tristate int8
+
+const (
+	tsFalse tristate = iota
+	tsTrue
+	tsUnknown
+)
+
+func tsOf(b bool) tristate {
+	if b {
+		return tsTrue
+	}
+	return tsFalse
+}
+
+type filterNode interface {
+	match(name string, attrs map[string]interface{}) bool
+	matchName(name string) tristate
+}
+
+type andNode struct{ l, r filterNode }
+type orNode struct{ l, r filterNode }
+type notNode struct{ x filterNode }
+
+func (n andNode) match(name string, attrs map[string]interface{}) bool {
+	return n.l.match(name, attrs) && n.r.match(name, attrs)
+}
+
+func (n orNode) match(name string, attrs map[string]interface{}) bool {
+	return n.l.match(name, attrs) || n.r.match(name, attrs)
+}
+
+func (n notNode) match(name string, attrs map[string]interface{}) bool {
+	return !n.x.match(name, attrs)
+}
+
+func (n andNode) matchName(name string) tristate {
+	l := n.l.matchName(name)
+	if l == tsFalse {
+		return tsFalse
+	}
+	r := n.r.matchName(name)
+	if r == tsFalse {
+		return tsFalse
+	}
+	if l == tsTrue && r == tsTrue {
+		return tsTrue
+	}
+	return tsUnknown
+}
+
+func (n orNode) matchName(name string) tristate {
+	l := n.l.matchName(name)
+	if l == tsTrue {
+		return tsTrue
+	}
+	r := n.r.matchName(name)
+	if r == tsTrue {
+		return tsTrue
+	}
+	if l == tsFalse && r == tsFalse {
+		return tsFalse
+	}
+	return tsUnknown
+}
+
+func (n notNode) matchName(name string) tristate {
+	switch n.x.matchName(name) {
+	case tsTrue:
+		return tsFalse
+	case tsFalse:
+		return tsTrue
+	}
+	return tsUnknown
+}
+
+// operand of a comparison: the name, an attr or a literal
+type operand struct {
+	name  bool
+	key   string // of the attr, if not the name nor a literal
+	value interface{}
+}
+
+func (o *operand) isAttr() bool {
+	return !o.name && o.value == nil
+}
+
+func (o *operand) get(name string, attrs map[string]interface{}) (interface{}, bool) {
+	switch {
+	case o.name:
+		return name, true
+	case o.value != nil:
+		return o.value, true
+	}
+	v, ok := attrs[o.key]
+	return v, ok
+}
+
+type cmpNode struct {
+	op   string
+	l, r operand
+	re   *regexp.Regexp // of =~ and !~
+}
+
+func (n *cmpNode) match(name string, attrs map[string]interface{}) bool {
+	l, ok := n.l.get(name, attrs)
+	if !ok {
+		return false
+	}
+	if n.re != nil {
+		s, ok := normalize(l).(string)
+		return ok && n.re.MatchString(s) == (n.op == "=~")
+	}
+	r, ok := n.r.get(name, attrs)
+	return ok && compare(n.op, normalize(l), normalize(r))
+}
+
+func (n *cmpNode) matchName(name string) tristate {
+	if n.l.isAttr() || n.r.isAttr() {
+		return tsUnknown
+	}
+	return tsOf(n.match(name, nil))
+}
+
+// boolNode is a bare attr, or a bare true or false
+type boolNode struct{ o operand }
+
+func (n boolNode) match(name string, attrs map[string]interface{}) bool {
+	v, _ := n.o.get(name, attrs)
+	return v == true
+}
+
+func (n boolNode) matchName(name string) tristate {
+	if n.o.isAttr() {
+		return tsUnknown
+	}
+	return tsOf(n.match(name, nil))
+}
+
+// normalize a value to a string, an int64, an uint64 above the int64s,
+// a float64 or a bool
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case net.IP:
+		return x.String()
+	case float32:
+		return float64(x)
+	case int16:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case byte:
+		return int64(x)
+	case uint64:
+		if x <= math.MaxInt64 {
+			return int64(x)
+		}
+	}
+	return v
+}
+
+// cmpNumbers compares two numbers of normalize
+func cmpNumbers(a, b interface{}) (int, bool) {
+	fa, aFloat := a.(float64)
+	fb, bFloat := b.(float64)
+	if aFloat || bFloat {
+		if !aFloat {
+			fa, aFloat = toFloat(a)
+		}
+		if !bFloat {
+			fb, bFloat = toFloat(b)
+		}
+		if !aFloat || !bFloat || math.IsNaN(fa) || math.IsNaN(fb) {
+			return 0, false
+		}
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		case uint64:
+			return -1, true
+		}
+	case uint64:
+		switch y := b.(type) {
+		case int64:
+			return 1, true
+		case uint64:
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	}
+	return 0, false
+}
+
+// compare two normalized values
+func compare(op string, a, b interface{}) bool {
+	var c int
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(x, y)
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "==":
+			return x == y
+		case "!=":
+			return x != y
+		}
+		return false
+	default:
+		var ok bool
+		if c, ok = cmpNumbers(a, b); !ok {
+			return false
+		}
+	}
+
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// CompileFilter compiles the filter expression
+func CompileFilter(expr string) (*Filter, error) {
+	p := filterParser{expr: expr}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// String returns the expression of the filter
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether the event matches the filter
+func (f *Filter) Match(lwe *LwesEvent) bool {
+	return f.root.match(lwe.Name, lwe.Attrs)
+}
+
+// MatchName reports whether the events of the name match the filter,
+// whatever their attrs; decided is false if it depends on the attrs
+func (f *Filter) MatchName(name string) (match, decided bool) {
+	switch f.root.matchName(name) {
+	case tsTrue:
+		return true, true
+	case tsFalse:
+		return false, true
+	}
+	return false, false
+}
+
+// the tokens of the filter expressions
+const (
+	tokEOF = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type filterToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+type filterParser struct {
+	expr string
+	pos  int
+	tok  filterToken
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("lwes: filter at %d: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == ':'
+}
+
+// next scans the next token
+func (p *filterParser) next() error {
+	for p.pos < len(p.expr) && strings.IndexByte(" \t\r\n", p.expr[p.pos]) >= 0 {
+		p.pos++
+	}
+	start := p.pos
+	p.tok = filterToken{pos: start}
+	if p.pos >= len(p.expr) {
+		p.tok.kind = tokEOF
+		return nil
+	}
+
+	c := p.expr[p.pos]
+	switch {
+	case c == '"':
+		quoted, err := strconv.QuotedPrefix(p.expr[p.pos:])
+		if err != nil {
+			return p.errorf("bad quoted string")
+		}
+		p.pos += len(quoted)
+		p.tok.kind = tokString
+		p.tok.text, _ = strconv.Unquote(quoted)
+		return nil
+	case c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.':
+		for p.pos < len(p.expr) && (isIdentByte(p.expr[p.pos]) || strings.IndexByte("+-", p.expr[p.pos]) >= 0) {
+			p.pos++
+		}
+		p.tok.kind = tokNumber
+	case isIdentByte(c):
+		for p.pos < len(p.expr) && isIdentByte(p.expr[p.pos]) {
+			p.pos++
+		}
+		p.tok.kind = tokIdent
+	default:
+		p.tok.kind = tokOp
+		for _, op := range []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")"} {
+			if strings.HasPrefix(p.expr[p.pos:], op) {
+				p.pos += len(op)
+				p.tok.text = op
+				return nil
+			}
+		}
+		return p.errorf("unexpected %q", c)
+	}
+	p.tok.text = p.expr[start:p.pos]
+	return nil
+}
+
+func (p *filterParser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = andNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	switch {
+	case p.isOp("!"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	case p.isOp("("):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		return x, p.next()
+	}
+	return p.parseCmp()
+}
+
+func (p *filterParser) parseCmp() (filterNode, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp {
+		return boolNode{l}, nil
+	}
+	op := p.tok.text
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+	default:
+		return boolNode{l}, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	at := p.tok
+	r, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &cmpNode{op: op, l: l, r: r}
+	if op == "=~" || op == "!~" {
+		s, ok := r.value.(string)
+		if !ok || at.kind != tokString {
+			p.tok = at
+			return nil, p.errorf("expected a quoted regexp after %s", op)
+		}
+		if n.re, err = regexp.Compile("^(?:" + s + ")$"); err != nil {
+			p.tok = at
+			return nil, p.errorf("bad regexp: %v", err)
+		}
+	}
+	return n, nil
+}
+
+func (p *filterParser) parseOperand() (operand, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		return operand{value: tok.text}, p.next()
+	case tokNumber:
+		v := inferValue(tok.text, false)
+		switch v.(type) {
+		case int64, uint64, float64:
+			return operand{value: v}, p.next()
+		}
+		return operand{}, p.errorf("bad number %q", tok.text)
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return operand{}, err
+		}
+		switch tok.text {
+		case "name":
+			return operand{name: true}, nil
+		case "true", "false":
+			return operand{value: tok.text == "true"}, nil
+		case "attr":
+			if !p.isOp("(") {
+				break
+			}
+			if err := p.next(); err != nil {
+				return operand{}, err
+			}
+			if p.tok.kind != tokString {
+				return operand{}, p.errorf("expected a quoted key in attr()")
+			}
+			key := p.tok.text
+			if err := p.next(); err != nil {
+				return operand{}, err
+			}
+			if !p.isOp(")") {
+				return operand{}, p.errorf("expected ')'")
+			}
+			return operand{key: key}, p.next()
+		}
+		return operand{key: tok.text}, nil
+	case tokEOF:
+		return operand{}, p.errorf("unexpected end of the filter")
+	}
+	return operand{}, p.errorf("unexpected %q", tok.text)
+}
@@ -0,0 +1,135 @@
+package lwes
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go/internal/stattag"
+)
+
+func TestFilter(t *testing.T) {
+	lwe := NewLwesEvent("MonDemand::StatsMsg")
+	lwe.Set("caller_label", "broker")
+	lwe.Set("num", uint16(3))
+	lwe.Set("big", uint64(1<<63))
+	lwe.Set("ratio", float32(0.5))
+	lwe.Set("ip", net.IP{10, 0, 0, 1})
+	lwe.Set("ok", true)
+	lwe.Set("name", "attr of the key name")
+
+	for expr, want := range map[string]bool{
+		`name =~ "MonDemand::.*" && caller_label == "broker" && num > 0`: true,
+		`name =~ "MonDemand"`:                       false,
+		`name !~ "Test::.*"`:                        true,
+		`num == 3 && num >= 3 && num <= 3`:          true,
+		`num != 3 || num < 3`:                       false,
+		`big > num && big > 9223372036854775807`:    true,
+		`ratio < 1 && ratio > 0.25 && 0.5 == ratio`: true,
+		`ip == "10.0.0.1" && ip =~ "10\\..*"`:       true,
+		`ok && ok == true && !(ok != true)`:         true,
+		`missing != 1 || missing == 1`:              false,
+		`!missing`:                                  true,
+		`num == "3" || caller_label > 1`:            false,
+		`attr("name") == "attr of the key name"`:    true,
+		`false || (true && !false)`:                 true,
+	} {
+		f, err := CompileFilter(expr)
+		if err != nil {
+			t.Fatalf("compiling %q: %v", expr, err)
+		}
+		if got := f.Match(lwe); got != want {
+			t.Errorf("%s: got %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestFilterMatchName(t *testing.T) {
+	for _, tc := range []struct {
+		expr           string
+		match, decided bool
+	}{
+		{`name == "A" && num > 0`, false, false},
+		{`name == "B" && num > 0`, false, true},
+		{`name == "B" || num > 0`, false, false},
+		{`name == "A" || num > 0`, true, true},
+		{`!(name =~ "A|B") && num > 0`, false, true},
+		{`num > 0`, false, false},
+	} {
+		f, err := CompileFilter(tc.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		match, decided := f.MatchName("A")
+		if decided != tc.decided || (decided && match != tc.match) {
+			t.Errorf("%s: got %v, %v, want %v, %v", tc.expr, match, decided, tc.match, tc.decided)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	for expr, want := range map[string]string{
+		``:                  "at 1: unexpected end",
+		`num >`:             "at 6: unexpected end",
+		`num > 1 &&`:        "unexpected end",
+		`(num > 1`:          "expected ')'",
+		`num ~ 1`:           "at 5: unexpected '~'",
+		`name =~ foo`:       "at 9: expected a quoted regexp",
+		`name =~ "("`:       "bad regexp",
+		`num > 1x`:          "bad number",
+		`num > 1 num`:       "unexpected \"num\"",
+		`attr(num) > 1`:     "expected a quoted key",
+		`caller == "broker`: "bad quoted string",
+	} {
+		_, err := CompileFilter(expr)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("compiling %q: got %v, want an error of %q", expr, err, want)
+		}
+	}
+}
+
+func TestServerFilter(t *testing.T) {
+	tr, src := NewPipe(10)
+	server := NewServer(src)
+	f, err := CompileFilter(`name == "Test::A" && i > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := server.(LwesModeServer).WaitLwesModeWith(LwesModeConfig{Workers: 1, Filter: f})
+	defer server.Stop()
+
+	em := NewEmitter(tr)
+	for i, name := range []string{"Test::A", "Test::B", "Test::A", "Test::A"} {
+		lwe := NewLwesEvent(name)
+		lwe.Set("i", int64(i))
+		em.Emit(lwe)
+	}
+
+	for _, want := range []int64{2, 3} {
+		select {
+		case lwe := <-out:
+			if lwe.Name != "Test::A" || lwe.Attrs["i"] != want {
+				t.Fatalf("got %v, want Test::A of i %d", lwe, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+		}
+	}
+
+	var metrics struct{ decoded, filtered int64 }
+	server.(metricsReporter).reportMetrics(func(name string, v interface{}) {
+		stattag.Enumerate(v, func(key, _ string, value int64) {
+			switch key {
+			case "packets_decoded":
+				metrics.decoded = value
+			case "packets_filtered":
+				metrics.filtered = value
+			}
+		})
+	})
+	// Test::B is filtered by its name, without decoding it
+	if metrics.decoded != 3 || metrics.filtered != 2 {
+		t.Fatalf("got %d decoded and %d filtered, want 3 and 2", metrics.decoded, metrics.filtered)
+	}
+}
@@ -0,0 +1,147 @@
+// Package cli holds the flags and the helpers shared by the commands
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lwes/lwes-go"
+)
+
+// the channels of the commands by default
+const (
+	DefaultListen = "239.5.1.100:11311"
+	DefaultEmit   = "lwes::239.5.1.100:11311"
+)
+
+// the usages of the -listen and -emit flags
+const (
+	ListenUsage = "the channel to listen on, as <addr>:<port>, unix:<path> or tcp:<addr>:<port>; repeatable (default " + DefaultListen + ")"
+	EmitUsage   = "the channel to emit to, like lwes::<ip>:<port>, lwes-udp:<ip>:<port>, lwes-tcp:<host>:<port> or lwes-unix:<path>; repeatable (default " + DefaultEmit + ")"
+)
+
+// ArrayFlags is a repeatable string flag
+type ArrayFlags []string
+
+func (i *ArrayFlags) String() string {
+	return strings.Join(*i, ",")
+}
+
+func (i *ArrayFlags) Set(value string) error {
+	*i = append(*i, value)
+	return nil
+}
+
+// OpenEmitter opens an emitter to the channels of the -emit flags, or to
+// DefaultEmit without any
+func OpenEmitter(emits []string) (*lwes.Emitter, error) {
+	if len(emits) == 0 {
+		emits = []string{DefaultEmit}
+	}
+	var cfg lwes.EmitterConfig
+	for _, emit := range emits {
+		if err := cfg.ParseFromString(emit); err != nil {
+			return nil, err
+		}
+	}
+	em := lwes.Open(cfg)
+	if em == nil {
+		return nil, errors.New("failed to open the emitter")
+	}
+	return em, nil
+}
+
+// RawEvent is an encoded event emitted as is
+type RawEvent []byte
+
+func (e RawEvent) MarshalBinary() ([]byte, error) {
+	return e, nil
+}
+
+// NameFilter selects the events by their name with the glob patterns of
+// the -name and -exclude flags
+type NameFilter struct {
+	Names    ArrayFlags // the patterns of the names selected; none for all
+	Excludes ArrayFlags // the patterns of the names not selected
+}
+
+// Validate checks the syntax of the patterns
+func (f *NameFilter) Validate() error {
+	for _, pattern := range append(append([]string(nil), f.Names...), f.Excludes...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad name pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Match reports whether the events of the name are selected
+func (f *NameFilter) Match(name string) bool {
+	for _, pattern := range f.Excludes {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(f.Names) == 0 {
+		return true
+	}
+	for _, pattern := range f.Names {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// StopOnSignal returns a channel closed on SIGINT or SIGTERM, or after
+// the timeout if it's positive
+func StopOnSignal(timeout time.Duration) <-chan struct{} {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+		case <-timer:
+		}
+		signal.Stop(sigs)
+		close(stop)
+	}()
+	return stop
+}
+
+// Stopped reports whether the stop channel is closed
+func Stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitUntil waits until the due time to pace the events; it returns
+// false if stopped first
+func WaitUntil(due time.Time, stop <-chan struct{}) bool {
+	if wait := time.Until(due); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-stop:
+			return false
+		}
+	}
+	return !Stopped(stop)
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNameFilter(t *testing.T) {
+	f := NameFilter{Names: ArrayFlags{"MonDemand::*"}, Excludes: ArrayFlags{"MonDemand::LogMsg"}}
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"MonDemand::StatsMsg": true,
+		"MonDemand::LogMsg":   false,
+		"Other::Event":        false,
+	} {
+		if got := f.Match(name); got != want {
+			t.Errorf("Match(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	f = NameFilter{Excludes: ArrayFlags{"["}}
+	if err := f.Validate(); err == nil {
+		t.Fatal("expected an error for a bad pattern")
+	}
+}
+
+func TestWaitUntil(t *testing.T) {
+	stop := make(chan struct{})
+	began := time.Now()
+	if !WaitUntil(began.Add(10*time.Millisecond), stop) {
+		t.Fatal("expected the wait not stopped")
+	}
+	if took := time.Since(began); took < 10*time.Millisecond {
+		t.Fatalf("waited %v, less than 10ms", took)
+	}
+
+	close(stop)
+	if WaitUntil(time.Now().Add(time.Hour), stop) || WaitUntil(time.Time{}, stop) {
+		t.Fatal("expected the wait stopped")
+	}
+}
@@ -0,0 +1,109 @@
+// Package stattag parses the mondemand_stat struct tags of the metrics
+// structs, for the mondemand client and the prometheus handler of lwes
+package stattag
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Tag is the struct tag of the fields reported as stats, like
+// `mondemand_stat:"queue_size,gauge"`; the type is counter by default
+const Tag = "mondemand_stat"
+
+// the types of the stats
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// field is a field of a struct reported as a stat
+type field struct {
+	index []int
+	key   string
+	typ   string
+	kind  reflect.Kind
+}
+
+// the plans of the struct types seen, like the cache of encoding/json
+var plans sync.Map // map[reflect.Type][]field
+
+func plan(t reflect.Type) []field {
+	if p, ok := plans.Load(t); ok {
+		return p.([]field)
+	}
+	p, _ := plans.LoadOrStore(t, buildPlan(t, nil, ""))
+	return p.([]field)
+}
+
+// buildPlan lists the tagged int, uint and float fields of t; the
+// fields of a tagged nested struct are prefixed with its key and "_",
+// the ones of an embedded struct are not prefixed
+func buildPlan(t reflect.Type, index []int, prefix string) []field {
+	var p []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup(Tag)
+		if tag == "-" {
+			continue
+		}
+
+		key, typ := tag, Counter
+		if words := strings.SplitN(tag, ",", 2); len(words) == 2 {
+			key, typ = words[0], words[1]
+		}
+		fidx := append(append([]int(nil), index...), i)
+
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			switch {
+			case f.Anonymous && key == "":
+				p = append(p, buildPlan(f.Type, fidx, prefix)...)
+			case tagged && key != "":
+				p = append(p, buildPlan(f.Type, fidx, prefix+key+"_")...)
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64:
+			if !tagged || key == "" || (typ != Counter && typ != Gauge) {
+				continue
+			}
+			p = append(p, field{fidx, prefix + key, typ, f.Type.Kind()})
+		}
+	}
+	return p
+}
+
+func (f *field) value(v reflect.Value) int64 {
+	fv := v.FieldByIndex(f.index)
+	switch f.kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int64(fv.Float())
+	default:
+		return fv.Int()
+	}
+}
+
+// Enumerate calls f with the key, the type and the value of the tagged
+// fields of the struct v, or of the struct v points to, in the order of
+// the fields; the floats are truncated. Anything else is ignored.
+func Enumerate(v interface{}, f func(key, typ string, value int64)) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+
+	p := plan(rv.Type())
+	for i := range p {
+		f(p[i].key, p[i].typ, p[i].value(rv))
+	}
+}
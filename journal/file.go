@@ -0,0 +1,243 @@
+package journal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileConfig configures a FileWriter; zero values mean no limits
+type FileConfig struct {
+	// Path of the journal being written, like "all_events.log.gz"; it's
+	// gzipped if it ends with ".gz". A rotated journal is renamed to
+	// "all_events.log.<start>.<end>.gz" with the unix seconds it was
+	// started and rotated.
+	Path string
+
+	MaxSize int64         // rotate after this many bytes of headers and events
+	MaxAge  time.Duration // rotate after the journal is started this long
+
+	// Fsync the journal when it's synced, rotated or closed
+	Fsync bool
+	// SyncInterval flushes the buffered events to the file, and fsyncs
+	// them with Fsync, at most this long after they are written;
+	// 0 flushes only when rotated or closed
+	SyncInterval time.Duration
+}
+
+// FileWriter writes a journal file, and rotates it by size, age or on
+// demand; it's safe for concurrent use
+type FileWriter struct {
+	cfg FileConfig
+	now func() time.Time
+
+	mutex    sync.Mutex
+	file     *os.File
+	bw       *bufio.Writer
+	gz       *gzip.Writer // nil if not gzipped
+	w        *Writer
+	started  time.Time
+	size     int64
+	lastSync time.Time
+	dirty    bool // written since the last sync
+}
+
+// OpenFile starts writing the journal of the cfg, appending to the file
+// of its path if it exists
+func OpenFile(cfg FileConfig) (*FileWriter, error) {
+	fw := &FileWriter{cfg: cfg, now: time.Now}
+	if err := fw.open(); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+func (fw *FileWriter) gzipped() bool {
+	return strings.HasSuffix(fw.cfg.Path, ".gz")
+}
+
+func (fw *FileWriter) open() error {
+	f, err := os.OpenFile(fw.cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fw.file = f
+	fw.bw = bufio.NewWriterSize(f, 64*1024)
+	if fw.gzipped() {
+		fw.gz = gzip.NewWriter(fw.bw)
+		fw.w = NewWriter(fw.gz)
+	} else {
+		fw.gz = nil
+		fw.w = NewWriter(fw.bw)
+	}
+	fw.started = fw.now()
+	fw.lastSync = fw.started
+	fw.size = 0
+	fw.dirty = false
+	return nil
+}
+
+// WriteEvent writes an event to the journal, rotating it first if due
+func (fw *FileWriter) WriteEvent(h Header, event []byte) error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fw.file == nil {
+		return os.ErrClosed
+	}
+
+	now := fw.now()
+	if fw.dueLocked(now, int64(HeaderSize+len(event))) {
+		if err := fw.rotateLocked(now); err != nil {
+			return err
+		}
+	}
+
+	if err := fw.w.WriteEvent(h, event); err != nil {
+		return err
+	}
+	fw.size += int64(HeaderSize + len(event))
+	fw.dirty = true
+
+	if fw.cfg.SyncInterval > 0 && now.Sub(fw.lastSync) >= fw.cfg.SyncInterval {
+		return fw.syncLocked(now)
+	}
+	return nil
+}
+
+// dueLocked reports whether the journal is to be rotated before
+// writing n more bytes
+func (fw *FileWriter) dueLocked(now time.Time, n int64) bool {
+	if fw.size == 0 {
+		return false
+	}
+	return (fw.cfg.MaxSize > 0 && fw.size+n > fw.cfg.MaxSize) ||
+		(fw.cfg.MaxAge > 0 && now.Sub(fw.started) >= fw.cfg.MaxAge)
+}
+
+// Tick does the rotation by age and the sync by interval which are due
+// while no events are written; call it periodically
+func (fw *FileWriter) Tick() error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fw.file == nil {
+		return os.ErrClosed
+	}
+
+	now := fw.now()
+	if fw.dueLocked(now, 0) {
+		return fw.rotateLocked(now)
+	}
+	if fw.dirty && fw.cfg.SyncInterval > 0 && now.Sub(fw.lastSync) >= fw.cfg.SyncInterval {
+		return fw.syncLocked(now)
+	}
+	return nil
+}
+
+// Sync flushes the events written to the file, and fsyncs it with Fsync
+func (fw *FileWriter) Sync() error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fw.file == nil {
+		return os.ErrClosed
+	}
+	return fw.syncLocked(fw.now())
+}
+
+func (fw *FileWriter) syncLocked(now time.Time) error {
+	fw.lastSync = now
+	fw.dirty = false
+	if fw.gz != nil {
+		if err := fw.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := fw.bw.Flush(); err != nil {
+		return err
+	}
+	if fw.cfg.Fsync {
+		return fw.file.Sync()
+	}
+	return nil
+}
+
+// Rotate renames the journal and starts a new one, if anything is
+// written to it
+func (fw *FileWriter) Rotate() error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fw.file == nil {
+		return os.ErrClosed
+	}
+	if fw.size == 0 {
+		return nil
+	}
+	return fw.rotateLocked(fw.now())
+}
+
+func (fw *FileWriter) rotateLocked(now time.Time) error {
+	started := fw.started
+	if err := fw.closeLocked(); err != nil {
+		return err
+	}
+	// keep writing to the path even if the rename failed
+	rerr := os.Rename(fw.cfg.Path, fw.rotatedName(started, now))
+	if err := fw.open(); err != nil {
+		return err
+	}
+	return rerr
+}
+
+// rotatedName returns a name for the journal started and rotated at the
+// times, which doesn't exist yet
+func (fw *FileWriter) rotatedName(started, rotated time.Time) string {
+	base, ext := fw.cfg.Path, ""
+	if fw.gzipped() {
+		base, ext = strings.TrimSuffix(base, ".gz"), ".gz"
+	}
+	name := fmt.Sprintf("%s.%d.%d", base, started.Unix(), rotated.Unix())
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name + ext); os.IsNotExist(err) {
+			return name + ext
+		}
+		name = fmt.Sprintf("%s.%d.%d.%d", base, started.Unix(), rotated.Unix(), i)
+	}
+}
+
+func (fw *FileWriter) closeLocked() error {
+	var err error
+	if fw.gz != nil {
+		err = fw.gz.Close()
+	}
+	if ferr := fw.bw.Flush(); err == nil {
+		err = ferr
+	}
+	if fw.cfg.Fsync {
+		if serr := fw.file.Sync(); err == nil {
+			err = serr
+		}
+	}
+	if cerr := fw.file.Close(); err == nil {
+		err = cerr
+	}
+	fw.file = nil
+	return err
+}
+
+// Close flushes and closes the journal, without rotating it
+func (fw *FileWriter) Close() error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fw.file == nil {
+		return nil
+	}
+	return fw.closeLocked()
+}
@@ -0,0 +1,89 @@
+// Package journal reads and writes the lwes journals of the
+// lwes-journaller: the events received, each prefixed by a header of
+// its size, receipt time and sender, usually gzipped.
+package journal
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// the header of each event in a journal, in the big endian order:
+//
+//	uint16  the size of the event
+//	int64   the receipt time, in milliseconds since the epoch
+//	4 bytes the ipv4 address of the sender
+//	uint16  the port of the sender
+//	uint16  the site id
+//	4 bytes unused
+const HeaderSize = 22
+
+// MaxEventSize is the max size of an event in a journal
+const MaxEventSize = 0xffff
+
+var errEventTooLarge = errors.New("journal: event too large")
+
+// Header is the header of an event in a journal
+type Header struct {
+	ReceiptTime time.Time // with the millisecond precision
+	SenderIP    net.IP
+	SenderPort  uint16
+	SiteID      uint16
+}
+
+func (h *Header) encode(buf []byte, size int) {
+	binary.BigEndian.PutUint16(buf[0:], uint16(size))
+	binary.BigEndian.PutUint64(buf[2:], uint64(h.ReceiptTime.UnixMilli()))
+	ip := h.SenderIP.To4()
+	if ip == nil {
+		ip = net.IPv4zero.To4()
+	}
+	copy(buf[10:14], ip)
+	binary.BigEndian.PutUint16(buf[14:], h.SenderPort)
+	binary.BigEndian.PutUint16(buf[16:], h.SiteID)
+	copy(buf[18:22], []byte{0, 0, 0, 0})
+}
+
+// HeaderFrom returns the header of a packet received from the addr,
+// a *net.UDPAddr or a *net.TCPAddr, at the time; the zero time is now
+func HeaderFrom(addr net.Addr, received time.Time, siteID uint16) Header {
+	if received.IsZero() {
+		received = time.Now()
+	}
+	h := Header{ReceiptTime: received, SiteID: siteID}
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		h.SenderIP, h.SenderPort = a.IP, uint16(a.Port)
+	case *net.TCPAddr:
+		h.SenderIP, h.SenderPort = a.IP, uint16(a.Port)
+	}
+	return h
+}
+
+// Writer writes the events with their headers to an underlying writer,
+// which is not compressed by the Writer
+type Writer struct {
+	w   io.Writer
+	buf []byte
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, buf: make([]byte, 0, HeaderSize+1024)}
+}
+
+// WriteEvent writes the header and the encoded event in a single write
+func (w *Writer) WriteEvent(h Header, event []byte) error {
+	if len(event) > MaxEventSize {
+		return errEventTooLarge
+	}
+	buf := w.buf[:HeaderSize]
+	h.encode(buf, len(event))
+	buf = append(buf, event...)
+	w.buf = buf[:0]
+
+	_, err := w.w.Write(buf)
+	return err
+}
@@ -0,0 +1,254 @@
+package journal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go"
+)
+
+func TestWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	h := Header{
+		ReceiptTime: time.UnixMilli(0x0102030405),
+		SenderIP:    net.IPv4(10, 1, 2, 3),
+		SenderPort:  0x0607,
+		SiteID:      0x0809,
+	}
+	if err := w.WriteEvent(h, []byte("event")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		0, 5, // size
+		0, 0, 0, 0x01, 0x02, 0x03, 0x04, 0x05, // receipt time
+		10, 1, 2, 3, // sender ip
+		0x06, 0x07, // sender port
+		0x08, 0x09, // site id
+		0, 0, 0, 0, // unused
+		'e', 'v', 'e', 'n', 't',
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got % x, want % x", buf.Bytes(), want)
+	}
+
+	if err := w.WriteEvent(h, make([]byte, MaxEventSize+1)); err == nil {
+		t.Fatal("expected an event too large for the header")
+	}
+}
+
+func gunzip(t *testing.T, path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFileWriterRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "all_events.log.gz")
+
+	// two events of 32 bytes each per journal
+	fw, err := OpenFile(FileConfig{Path: path, MaxSize: 64, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	fw.now = func() time.Time { return now }
+	fw.started = now
+
+	event := []byte("0123456789")
+	for i := 0; i < 3; i++ {
+		if err := fw.WriteEvent(Header{ReceiptTime: now}, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotated := filepath.Join(dir, "all_events.log.1000.1000.gz")
+	if n := len(gunzip(t, rotated)); n != 2*(HeaderSize+len(event)) {
+		t.Fatalf("got %d bytes in the rotated journal", n)
+	}
+
+	// by age, and again on demand after the same second
+	now = now.Add(time.Hour)
+	if err := fw.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(gunzip(t, filepath.Join(dir, "all_events.log.1000.4600.gz"))); n != HeaderSize+len(event) {
+		t.Fatalf("got %d bytes in the journal rotated by age", n)
+	}
+	fw.WriteEvent(Header{ReceiptTime: now}, event)
+	if err := fw.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	fw.WriteEvent(Header{ReceiptTime: now}, event)
+	if err := fw.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"all_events.log.4600.4600.gz", "all_events.log.4600.4600.1.gz"} {
+		if n := len(gunzip(t, filepath.Join(dir, name))); n != HeaderSize+len(event) {
+			t.Fatalf("got %d bytes in %s", n, name)
+		}
+	}
+
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.WriteEvent(Header{}, event); err != os.ErrClosed {
+		t.Fatalf("got %v writing after Close", err)
+	}
+}
+
+func TestFileWriterSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	fw, err := OpenFile(FileConfig{Path: path, Fsync: true, SyncInterval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+	now := time.Unix(1000, 0)
+	fw.now = func() time.Time { return now }
+	fw.lastSync = now
+
+	fw.WriteEvent(Header{ReceiptTime: now}, []byte("event"))
+	if fi, _ := os.Stat(path); fi.Size() != 0 {
+		t.Fatalf("got %d bytes flushed before the interval", fi.Size())
+	}
+	now = now.Add(time.Second)
+	if err := fw.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != HeaderSize+5 {
+		t.Fatalf("got %d bytes flushed after the interval", fi.Size())
+	}
+}
+
+func TestReader(t *testing.T) {
+	lwe := lwes.NewLwesEvent("Test::Event")
+	lwe.Set("i", int64(1))
+	event, err := lwes.Marshal(lwe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Header{
+		ReceiptTime: time.UnixMilli(1500000000123),
+		SenderIP:    net.IPv4(10, 1, 2, 3).To4(),
+		SenderPort:  1234,
+		SiteID:      7,
+	}
+
+	var plain, gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	for _, w := range []*Writer{NewWriter(&plain), NewWriter(zw)} {
+		for i := 0; i < 2; i++ {
+			if err := w.WriteEvent(h, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	zw.Close()
+
+	for _, journal := range [][]byte{plain.Bytes(), gzipped.Bytes()} {
+		jr, err := NewReader(bytes.NewReader(journal))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, raw, err := jr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.ReceiptTime.Equal(h.ReceiptTime) || !got.SenderIP.Equal(h.SenderIP) ||
+			got.SenderPort != h.SenderPort || got.SiteID != h.SiteID || !bytes.Equal(raw, event) {
+			t.Fatalf("got %+v %q, want %+v %q", got, raw, h, event)
+		}
+
+		_, decoded, err := jr.ReadEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Name != "Test::Event" || decoded.Attrs["i"] != int64(1) ||
+			decoded.Attrs[lwes.ReceiptTimeKey] != int64(1500000000123) ||
+			!decoded.Attrs[lwes.SenderIPKey].(net.IP).Equal(h.SenderIP) ||
+			decoded.Attrs[lwes.SenderPortKey] != uint16(1234) {
+			t.Fatalf("unexpected event %v", decoded)
+		}
+
+		if _, _, err := jr.Next(); err != io.EOF {
+			t.Fatalf("got %v at the end of the journal", err)
+		}
+	}
+
+	jr, _ := NewReader(bytes.NewReader(plain.Bytes()[:HeaderSize+3]))
+	if _, _, err := jr.Next(); err == nil || err == io.EOF {
+		t.Fatalf("got %v for a truncated event", err)
+	}
+}
+
+func TestJournalTCP(t *testing.T) {
+	server, err := lwes.Listen("tcp:127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	var cfg lwes.EmitterConfig
+	if err := cfg.ParseFromString("lwes-tcp:" + server.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	em := lwes.Open(cfg)
+	defer em.Close()
+	before := time.Now().Truncate(time.Millisecond)
+	if err := em.Emit(lwes.NewLwesEvent("Test::Event")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	select {
+	case rb := <-server.DataChan():
+		if err := w.WriteEvent(HeaderFrom(rb.Addr(), rb.ReceivedAt(), 1), rb.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		rb.Done()
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event received")
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.ReceiptTime.Before(before) || h.ReceiptTime.After(time.Now()) {
+		t.Fatalf("unexpected receipt time %v", h.ReceiptTime)
+	}
+	if !h.SenderIP.Equal(net.IPv4(127, 0, 0, 1)) || h.SenderPort == 0 {
+		t.Fatalf("unexpected sender %v:%d", h.SenderIP, h.SenderPort)
+	}
+}
+
+func TestHeaderFromZeroTime(t *testing.T) {
+	before := time.Now()
+	if h := HeaderFrom(nil, time.Time{}, 0); h.ReceiptTime.Before(before) {
+		t.Fatalf("expected the zero time replaced by now, got %v", h.ReceiptTime)
+	}
+}
@@ -0,0 +1,113 @@
+package journal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/lwes/lwes-go"
+)
+
+// Reader iterates the headers and the events of a journal, gzipped or
+// plain
+type Reader struct {
+	r      *bufio.Reader
+	closer io.Closer // of the file opened by OpenReader
+
+	header [HeaderSize]byte
+	event  []byte
+}
+
+// NewReader reads a journal from r, gunzipping it if it starts with the
+// gzip magic bytes
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReaderSize(zr, 64*1024)
+	}
+	return &Reader{r: br, event: make([]byte, 0, 1024)}, nil
+}
+
+// OpenReader opens a journal file; the Reader must be closed
+func OpenReader(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	jr, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	jr.closer = f
+	return jr, nil
+}
+
+// Next returns the header and the encoded event of the next entry of
+// the journal, or io.EOF at its end; the event is valid until the next
+// call of Next
+func (jr *Reader) Next() (Header, []byte, error) {
+	if _, err := io.ReadFull(jr.r, jr.header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Header{}, nil, fmt.Errorf("journal: truncated header: %w", err)
+		}
+		return Header{}, nil, err
+	}
+
+	buf := jr.header[:]
+	size := int(binary.BigEndian.Uint16(buf[0:]))
+	h := Header{
+		ReceiptTime: time.UnixMilli(int64(binary.BigEndian.Uint64(buf[2:]))),
+		SenderIP:    net.IPv4(buf[10], buf[11], buf[12], buf[13]).To4(),
+		SenderPort:  binary.BigEndian.Uint16(buf[14:]),
+		SiteID:      binary.BigEndian.Uint16(buf[16:]),
+	}
+
+	if cap(jr.event) < size {
+		jr.event = make([]byte, size)
+	}
+	jr.event = jr.event[:size]
+	if _, err := io.ReadFull(jr.r, jr.event); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Header{}, nil, fmt.Errorf("journal: truncated event: %w", err)
+	}
+	return h, jr.event, nil
+}
+
+// ReadEvent returns the header and the decoded event of the next entry
+// of the journal, with the receipt time and the sender of the header as
+// the attributes of the event, or io.EOF at its end
+func (jr *Reader) ReadEvent() (Header, *lwes.LwesEvent, error) {
+	h, event, err := jr.Next()
+	if err != nil {
+		return h, nil, err
+	}
+
+	lwe := new(lwes.LwesEvent)
+	if err := lwe.UnmarshalBinary(event); err != nil {
+		return h, nil, err
+	}
+	lwe.Set(lwes.ReceiptTimeKey, h.ReceiptTime.UnixMilli())
+	lwe.Set(lwes.SenderIPKey, h.SenderIP)
+	lwe.Set(lwes.SenderPortKey, h.SenderPort)
+	return h, lwe, nil
+}
+
+// Close the file opened by OpenReader
+func (jr *Reader) Close() error {
+	if jr.closer == nil {
+		return nil
+	}
+	return jr.closer.Close()
+}
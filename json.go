@@ -0,0 +1,313 @@
+package lwes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+)
+
+// JSONFormat is the form of an event in JSON, like in lwes-erlang
+type JSONFormat int
+
+const (
+	// JSONTyped carries the type of each attribute, and decodes back to
+	// the same event:
+	//	{"EventName":"Test::Event","typed":{"count":{"type":"uint16","value":3}}}
+	JSONTyped JSONFormat = iota
+	// JSONPlain is for humans and log pipelines, with the ip addresses as
+	// strings; it decodes back with the integers as int64 and the other
+	// numbers as float64:
+	//	{"EventName":"Test::Event","count":3}
+	JSONPlain
+)
+
+// the key of the event name, and of the typed attributes
+const (
+	jsonNameKey  = "EventName"
+	jsonTypedKey = "typed"
+)
+
+// the type names of the typed JSON, the text and the ESF, as in the ESF
+// files and lwes-erlang
+var typeNames = map[byte]string{
+	LWES_TYPE_U_INT_16:    "uint16",
+	LWES_TYPE_INT_16:      "int16",
+	LWES_TYPE_U_INT_32:    "uint32",
+	LWES_TYPE_INT_32:      "int32",
+	LWES_TYPE_STRING:      "string",
+	LWES_TYPE_IP_ADDR:     "ip_addr",
+	LWES_TYPE_INT_64:      "int64",
+	LWES_TYPE_U_INT_64:    "uint64",
+	LWES_TYPE_BOOLEAN:     "boolean",
+	LWES_TYPE_BYTE:        "byte",
+	LWES_TYPE_FLOAT:       "float",
+	LWES_TYPE_DOUBLE:      "double",
+	LWES_TYPE_LONG_STRING: "long_string",
+}
+
+func knownType(name string) bool {
+	for _, n := range typeNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// attrType returns the lwes type a value is encoded as
+func attrType(value interface{}) (byte, bool) {
+	switch v := value.(type) {
+	case uint16:
+		return LWES_TYPE_U_INT_16, true
+	case int16:
+		return LWES_TYPE_INT_16, true
+	case uint32:
+		return LWES_TYPE_U_INT_32, true
+	case int32:
+		return LWES_TYPE_INT_32, true
+	case string:
+		if len(v) > 65535 {
+			return LWES_TYPE_LONG_STRING, true
+		}
+		return LWES_TYPE_STRING, true
+	case net.IP:
+		return LWES_TYPE_IP_ADDR, true
+	case int64:
+		return LWES_TYPE_INT_64, true
+	case uint64:
+		return LWES_TYPE_U_INT_64, true
+	case bool:
+		return LWES_TYPE_BOOLEAN, true
+	case byte:
+		return LWES_TYPE_BYTE, true
+	case float32:
+		return LWES_TYPE_FLOAT, true
+	case float64:
+		return LWES_TYPE_DOUBLE, true
+	}
+	return 0, false
+}
+
+// appendJSONValue appends a value in JSON; the ip addresses are strings,
+// and so are the NaN and the infinities of the floats
+func appendJSONValue(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case net.IP:
+		return strconv.AppendQuote(buf, v.String()), nil
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return strconv.AppendQuote(buf, strconv.FormatFloat(float64(v), 'g', -1, 32)), nil
+		}
+		return strconv.AppendFloat(buf, float64(v), 'g', -1, 32), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.AppendQuote(buf, strconv.FormatFloat(v, 'g', -1, 64)), nil
+		}
+		return strconv.AppendFloat(buf, v, 'g', -1, 64), nil
+	}
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, bs...), nil
+}
+
+func appendJSONString(buf []byte, s string) []byte {
+	bs, _ := json.Marshal(s)
+	return append(buf, bs...)
+}
+
+// MarshalJSON implements the json.Marshaler interface, in the JSONTyped
+// form
+func (lwe *LwesEvent) MarshalJSON() ([]byte, error) {
+	return lwe.EncodeJSON(JSONTyped)
+}
+
+// EncodeJSON encodes the event in the format, with the attributes in
+// their order
+func (lwe *LwesEvent) EncodeJSON(format JSONFormat) ([]byte, error) {
+	buf := make([]byte, 0, 2*lwe.Size())
+	buf = append(buf, '{')
+	buf = appendJSONString(buf, jsonNameKey)
+	buf = append(buf, ':')
+	buf = appendJSONString(buf, lwe.Name)
+	if format == JSONTyped {
+		buf = append(buf, ',')
+		buf = appendJSONString(buf, jsonTypedKey)
+		buf = append(buf, ":{"...)
+	}
+
+	var err error
+	for i, key := range lwe.attr_keys {
+		value := lwe.Attrs[key]
+		typ, ok := attrType(value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T of %q", errUnsupportedDataType, value, key)
+		}
+
+		if i > 0 || format == JSONPlain {
+			buf = append(buf, ',')
+		}
+		buf = appendJSONString(buf, key)
+		buf = append(buf, ':')
+
+		if format == JSONTyped {
+			buf = append(buf, `{"type":`...)
+			buf = appendJSONString(buf, typeNames[typ])
+			buf = append(buf, `,"value":`...)
+		}
+		if buf, err = appendJSONValue(buf, value); err != nil {
+			return nil, err
+		}
+		if format == JSONTyped {
+			buf = append(buf, '}')
+		}
+	}
+
+	if format == JSONTyped {
+		buf = append(buf, '}')
+	}
+	buf = append(buf, '}')
+	return buf, nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, decoding
+// either of the JSONTyped and the JSONPlain forms
+func (lwe *LwesEvent) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	lwe.Name = ""
+	lwe.Attrs = make(map[string]interface{})
+	lwe.attr_keys = nil
+
+	for dec.More() {
+		key, err := nextKey(dec)
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case jsonNameKey:
+			if err := dec.Decode(&lwe.Name); err != nil {
+				return fmt.Errorf("lwes: bad %s: %w", jsonNameKey, err)
+			}
+		case jsonTypedKey:
+			if err := lwe.decodeTyped(dec); err != nil {
+				return err
+			}
+		default:
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return err
+			}
+			value, err := plainValue(v)
+			if err != nil {
+				return fmt.Errorf("lwes: attr %q: %w", key, err)
+			}
+			lwe.Set(key, value)
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("lwes: expected %v in JSON, got %v", delim, tok)
+	}
+	return nil
+}
+
+func nextKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("lwes: expected a key in JSON, got %v", tok)
+	}
+	return key, nil
+}
+
+func (lwe *LwesEvent) decodeTyped(dec *json.Decoder) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := nextKey(dec)
+		if err != nil {
+			return err
+		}
+
+		// the value is a number, a string or a boolean
+		var typed struct {
+			Type  string      `json:"type"`
+			Value interface{} `json:"value"`
+		}
+		if err := dec.Decode(&typed); err != nil {
+			return fmt.Errorf("lwes: attr %q: %w", key, err)
+		}
+
+		value, err := typedValue(typed.Type, typed.Value)
+		if err != nil {
+			return fmt.Errorf("lwes: attr %q: %w", key, err)
+		}
+		lwe.Set(key, value)
+	}
+	return expectDelim(dec, '}')
+}
+
+func typedValue(typ string, v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		// the NaN and the infinities of the floats are strings
+		switch typ {
+		case "string", "long_string", "ip_addr", "float", "double":
+			return parseValue(typ, x)
+		}
+	case bool:
+		if typ == "boolean" {
+			return x, nil
+		}
+	case json.Number:
+		switch typ {
+		case "string", "long_string", "ip_addr", "boolean":
+		default:
+			return parseValue(typ, x.String())
+		}
+	}
+	if !knownType(typ) {
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+	return nil, fmt.Errorf("not a %s: %v", typ, v)
+}
+
+// plainValue maps a plain JSON value to the closest lwes type
+func plainValue(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case string, bool:
+		return x, nil
+	case json.Number:
+		if i, err := strconv.ParseInt(x.String(), 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(x.String(), 10, 64); err == nil {
+			return u, nil
+		}
+		return strconv.ParseFloat(x.String(), 64)
+	}
+	return nil, fmt.Errorf("%w: %T", errUnsupportedDataType, v)
+}
@@ -0,0 +1,104 @@
+package lwes
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net"
+	"strings"
+	"testing"
+)
+
+func newTypedEvent() *LwesEvent {
+	lwe := NewLwesEvent("Test::Event")
+	lwe.Set("u16", uint16(1))
+	lwe.Set("i16", int16(-2))
+	lwe.Set("u32", uint32(3))
+	lwe.Set("i32", int32(-4))
+	lwe.Set("str", "hello \"world\"")
+	lwe.Set("ip", net.IP{10, 1, 2, 3})
+	lwe.Set("i64", int64(-5))
+	lwe.Set("u64", uint64(math.MaxUint64))
+	lwe.Set("bool", true)
+	lwe.Set("byte", byte(6))
+	lwe.Set("float", float32(1.5))
+	lwe.Set("double", math.Inf(-1))
+	lwe.Set("long", strings.Repeat("x", 70000))
+	return lwe
+}
+
+func TestJSONTypedRoundTrip(t *testing.T) {
+	want, err := Marshal(newTypedEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// from the binary, to JSON and back to the same binary
+	decoded := new(LwesEvent)
+	if err := Unmarshal(want, decoded); err != nil {
+		t.Fatal(err)
+	}
+	js, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(js, []byte(`{"EventName":"Test::Event","typed":{"u16":{"type":"uint16","value":1},`)) {
+		t.Fatalf("unexpected JSON %.100s", js)
+	}
+
+	lwe := new(LwesEvent)
+	if err := json.Unmarshal(js, lwe); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Marshal(lwe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got a different binary after the JSON round trip:\n%.200q\n%.200q", got, want)
+	}
+}
+
+func TestJSONPlain(t *testing.T) {
+	lwe := NewLwesEvent("Test::Event")
+	lwe.Set("count", uint16(3))
+	lwe.Set("ip", net.IP{127, 0, 0, 1})
+	lwe.Set("ratio", 0.5)
+	lwe.Set("ok", false)
+
+	js, err := lwe.EncodeJSON(JSONPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"EventName":"Test::Event","count":3,"ip":"127.0.0.1","ratio":0.5,"ok":false}`
+	if string(js) != want {
+		t.Fatalf("got %s, want %s", js, want)
+	}
+
+	decoded := new(LwesEvent)
+	if err := json.Unmarshal(js, decoded); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	decoded.Enumerate(func(key string, _ interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if decoded.Name != "Test::Event" || strings.Join(keys, ",") != "count,ip,ratio,ok" ||
+		decoded.Attrs["count"] != int64(3) || decoded.Attrs["ip"] != "127.0.0.1" ||
+		decoded.Attrs["ratio"] != 0.5 || decoded.Attrs["ok"] != false {
+		t.Fatalf("unexpected event %v", decoded)
+	}
+
+	for _, bad := range []string{
+		`[]`,
+		`{"EventName":"E","a":[1]}`,
+		`{"EventName":"E","typed":{"a":{"type":"uint16","value":70000}}}`,
+		`{"EventName":"E","typed":{"a":{"type":"ip_addr","value":"::1"}}}`,
+		`{"EventName":"E","typed":{"a":{"type":"unknown","value":1}}}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), new(LwesEvent)); err == nil {
+			t.Errorf("expected an error decoding %s", bad)
+		}
+	}
+}
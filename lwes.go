@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -36,17 +37,14 @@ type bufferedServer struct {
 	maxPacketSize int
 	maxQueueSize  int
 	serving       uint32
-	transport     *net.UDPConn
+	transport     PacketSource
+	addr          net.Addr // of the transport, kept after Stop
 	readBufPool   sync.Pool
 	startstop     chan struct{}
 	waitstop      chan struct{}
-	tick          *time.Ticker
 
-	reportIntv time.Duration
-	reportFunc func(string, interface{})
-
-	metricsLock sync.RWMutex
-	metrics     struct {
+	sink    sinkRef // the metrics are updated atomically
+	metrics struct {
 		QueueSize             int64 `mondemand_stat:"queue_size,gauge"`
 		PacketSize            int64 `mondemand_stat:"packet_size,gauge"`
 		BytesReceived         int64 `mondemand_stat:"bytes_received"`
@@ -58,14 +56,26 @@ type bufferedServer struct {
 		PacketsDecoded        int64 `mondemand_stat:"packets_decoded"`
 		PacketsDecodedPassed  int64 `mondemand_stat:"packets_decoded_passed"`
 		PacketsDroppedDecoded int64 `mondemand_stat:"packets_dropped_decoded"`
+		PacketsFiltered       int64 `mondemand_stat:"packets_filtered"`
+		PacketsSkipped        int64 `mondemand_stat:"packets_skipped"`
 		ReadError             int64 `mondemand_stat:"packets_read_error"`
 		ReadTimeout           int64 `mondemand_stat:"packets_read_timeout"`
 	}
 }
 
-// listen on the multicast "addr:port" form
+// listen on the multicast "addr:port" form, on a unix datagram
+// socket in the "unix:<path>" form, or on TCP in the "tcp:<addr>:<port>"
+// form for the length-prefixed events of the lwes-tcp transport, with
+// the default TCPServerConfig; ListenTCP sets the limits of the TCP
+// connections
 // return a server with the Server interface methods
 func Listen(multi_addrport string) (Server, error) {
+	if path, ok := strings.CutPrefix(multi_addrport, "unix:"); ok {
+		return ListenUnixgram(path, defaultSocketPerm)
+	}
+	if addrport, ok := strings.CutPrefix(multi_addrport, "tcp:"); ok {
+		return ListenTCP(addrport, TCPServerConfig{})
+	}
 
 	addr, err := net.ResolveUDPAddr("udp", multi_addrport)
 	if err != nil {
@@ -97,23 +107,42 @@ func Listen(multi_addrport string) (Server, error) {
 	// readBufPool := &sync.Pool{}
 	// New: func() interface{} { return &readBuf{buf: make([]byte, MAX_PACKET_SIZE)} },
 
-	s := &bufferedServer{
+	s := newBufferedServer(multi_addrport, dataChan, MAX_PACKET_SIZE)
+	s.start(conn)
+
+	return s, nil
+}
+
+// NewServer returns a server receiving the events from the source;
+// Listen is the constructor over the default UDP source
+func NewServer(src PacketSource) Server {
+	s := newBufferedServer(src.LocalAddr().String(), make(chan *readBuf, DEFAULT_QUEUE_SIZE), MAX_PACKET_SIZE)
+	s.start(src)
+
+	return s
+}
+
+// start serving the source in the background
+func (s *bufferedServer) start(src PacketSource) {
+	s.transport = src
+	s.addr = src.LocalAddr()
+
+	go s.Serve()
+
+	// wait it started before returning
+	<-s.startstop
+}
+
+func newBufferedServer(multi_addrport string, dataChan chan *readBuf, maxPacketSize int) *bufferedServer {
+	return &bufferedServer{
 		multi_addrport: multi_addrport,
 		dataChan:       dataChan,
-		transport:      conn,
 		maxQueueSize:   DEFAULT_QUEUE_SIZE,
-		maxPacketSize:  MAX_PACKET_SIZE,
+		maxPacketSize:  maxPacketSize,
 		// readBufPool:    readBufPool,
 		startstop: make(chan struct{}),
 		waitstop:  make(chan struct{}),
 	}
-
-	go s.Serve()
-
-	// wait it started before returning
-	<-s.startstop
-
-	return s, nil
 }
 
 func (s *bufferedServer) Serve() {
@@ -129,50 +158,24 @@ func (s *bufferedServer) Serve() {
 		s.transport.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
 		n, err := io.Copy(readBuf, s.transport)
 
-		s.metricsLock.Lock()
 		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
-			s.metrics.ReadTimeout++
-			s.metricsLock.Unlock()
+			s.sink.count(&s.metrics.ReadTimeout, "packets_read_timeout", 1)
 			continue
 		}
 
+		if err == io.EOF {
+			// the source is exhausted, nothing more to serve
+			go s.Stop()
+			break
+		}
+
 		if err != nil {
-			s.metrics.ReadError++
-			s.metricsLock.Unlock()
+			s.sink.count(&s.metrics.ReadError, "packets_read_error", 1)
 			continue
 		}
 
-		// atomic.AddInt64(&s.metrics.BytesReceived, n)
-		s.metrics.BytesReceived += n
-		// atomic.AddInt64(&s.metrics.PacketsReceived, 1)
-		s.metrics.PacketsReceived++
-		// atomic.StoreInt64(&s.metrics.PacketSize, int64(readBuf.Len()))
-		s.metrics.PacketSize = n
-		s.metricsLock.Unlock()
-
-		// must increase the counter before enqueue
-		s.datawait.Add(1)
-
-		s.metricsLock.Lock()
-		select {
-		case s.dataChan <- readBuf:
-			// atomic.AddInt64(&s.metrics.PacketsProcessed, 1)
-			s.metrics.PacketsProcessed++
-			// atomic.StoreInt64(&s.metrics.QueueSize, int64(len(s.dataChan)))
-			s.metrics.QueueSize = int64(len(s.dataChan))
-			s.metricsLock.Unlock()
-
-			// s.updateQueueSize(1)
+		if s.enqueue(readBuf, n) {
 			readBuf = NewFixedBuffer(&s.readBufPool, s.maxPacketSize)
-		default:
-			// atomic.AddInt64(&s.metrics.BytesDropped, n)
-			s.metrics.BytesDropped += n
-			// atomic.AddInt64(&s.metrics.PacketsDropped, 1)
-			s.metrics.PacketsDropped++
-			s.metricsLock.Unlock()
-
-			// drop one if didn't enqueue
-			s.datawait.Done()
 		}
 	}
 	runtime.UnlockOSThread()
@@ -180,10 +183,36 @@ func (s *bufferedServer) Serve() {
 	readBuf.Done()
 
 	s.startstop <- struct{}{}
+}
+
+// enqueue passes a received packet of n bytes to the decoding queue;
+// it returns false when the queue is full and the packet is dropped,
+// in which case the readBuf still belongs to the caller
+func (s *bufferedServer) enqueue(readBuf *readBuf, n int64) bool {
+	s.sink.count(&s.metrics.BytesReceived, "bytes_received", n)
+	s.sink.count(&s.metrics.PacketsReceived, "packets_received", 1)
+	s.sink.gauge(&s.metrics.PacketSize, "packet_size", n)
+
+	// must increase the counter before enqueue; the consumer decreases
+	// it by readBuf.Done
+	s.datawait.Add(1)
+	readBuf.wait = &s.datawait
 
-	if s.tick != nil {
-		// if MetricsReport ever enabled
-		s.tick.Stop()
+	select {
+	case s.dataChan <- readBuf:
+		s.sink.count(&s.metrics.PacketsProcessed, "packets_processed", 1)
+		s.sink.gauge(&s.metrics.QueueSize, "queue_size", int64(len(s.dataChan)))
+
+		// s.updateQueueSize(1)
+		return true
+	default:
+		s.sink.count(&s.metrics.BytesDropped, "bytes_dropped", n)
+		s.sink.count(&s.metrics.PacketsDropped, "packets_dropped", 1)
+
+		// drop one if didn't enqueue
+		readBuf.wait = nil
+		s.datawait.Done()
+		return false
 	}
 }
 
@@ -205,6 +234,12 @@ func (s *bufferedServer) Stop() {
 	s.transport.Close()
 	s.transport = nil
 
+	s.drain()
+}
+
+// drain waits until the queued packets are consumed, then closes the
+// channels and wakes up the waiters of the server
+func (s *bufferedServer) drain() {
 	// log.Printf("in stopping: waiting for dataChan stopping: %d:%d, %v\n", len(s.dataChan), cap(s.dataChan), s.metrics)
 
 	// for len(s.dataChan) > 0 {}
@@ -225,15 +260,13 @@ func (s *bufferedServer) Stop() {
 		s.lwesChan = nil
 	}
 
-	// non-blocking send msg
-	select {
-	case s.waitstop <- struct{}{}: // send an empty marker
-	default: // if no one waiting
-	}
+	// wake up all the waiters, including the ones coming later
+	close(s.waitstop)
 
 	log.Printf("lwes serving is done.")
 }
 
+// Wait blocks until the server is stopped
 func (s *bufferedServer) Wait() {
 	<-s.waitstop
 }
@@ -248,58 +281,98 @@ func (s *bufferedServer) DataChan() <-chan *readBuf {
 	return s.dataChan
 }
 
+// LwesModeConfig configures the decoding of WaitLwesModeWith
+type LwesModeConfig struct {
+	Workers int // the decoding workers, default runtime.NumCPU()
+
+	// Names are the names of the events decoded; the others are skipped
+	// by their name, without decoding their attrs. Nil decodes all the
+	// events.
+	Names []string
+
+	// Filter drops the events not matching before they are queued, by
+	// their name only when it decides; nil passes all the events
+	Filter *Filter
+}
+
 // wait in a mode of streaming decoded *LwesEvent
 func (s *bufferedServer) WaitLwesMode(num_workers int) <-chan *LwesEvent {
+	return s.WaitLwesModeWith(LwesModeConfig{Workers: num_workers})
+}
+
+// WaitLwesModeWith streams the decoded *LwesEvent like WaitLwesMode,
+// with the cfg
+func (s *bufferedServer) WaitLwesModeWith(cfg LwesModeConfig) <-chan *LwesEvent {
 	ch := make(chan *LwesEvent, s.maxQueueSize)
 	s.lwesChan = ch
 
 	// check
-	if num_workers == 0 {
-		num_workers = runtime.NumCPU()
+	if cfg.Workers == 0 {
+		cfg.Workers = runtime.NumCPU()
 	}
 
-	for i := 0; i < num_workers; i++ {
+	var names map[string]struct{}
+	if cfg.Names != nil {
+		names = make(map[string]struct{}, len(cfg.Names))
+		for _, name := range cfg.Names {
+			names[name] = struct{}{}
+		}
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
 		s.waitworkers.Add(1)
-		go s.lwesdecoder(i, s.dataChan)
+		go s.lwesdecoder(i, s.dataChan, names, cfg.Filter)
 	}
 
 	return ch
 }
 
-func (s *bufferedServer) lwesdecoder(idx int, dataChan <-chan *readBuf) {
+func (s *bufferedServer) lwesdecoder(idx int, dataChan <-chan *readBuf, names map[string]struct{}, filter *Filter) {
 	lwe := new(LwesEvent)
 	for rbuf := range dataChan {
-		// decrement the data wait counters
-		s.datawait.Done()
+		// skip decoding the attrs of the names not wanted, and if the name
+		// decides the filter
+		if names != nil || filter != nil {
+			if name, ok := nameBytes(rbuf.Bytes()); ok {
+				if _, wanted := names[string(name)]; names != nil && !wanted {
+					rbuf.Done()
+					s.sink.count(&s.metrics.PacketsSkipped, "packets_skipped", 1)
+					continue
+				}
+				if filter != nil {
+					if match, decided := filter.MatchName(string(name)); decided && !match {
+						rbuf.Done()
+						s.sink.count(&s.metrics.PacketsFiltered, "packets_filtered", 1)
+						continue
+					}
+				}
+			}
+		}
 
 		err := lwe.UnmarshalBinary(rbuf.Bytes())
 
-		s.metricsLock.Lock()
+		// the event is a copy; the Done decrements the data wait counters
+		rbuf.Done()
+
 		if err != nil {
 			// update some counters
-			// atomic.AddInt64(&s.metrics.PacketsInvalid, 1)
-			s.metrics.PacketsInvalid++
-			s.metricsLock.Unlock()
+			s.sink.count(&s.metrics.PacketsInvalid, "packets_invalid", 1)
 			continue
 		}
-		s.metricsLock.Unlock()
 
-		rbuf.Done()
+		s.sink.count(&s.metrics.PacketsDecoded, "packets_decoded", 1)
 
-		s.metricsLock.Lock()
-		// atomic.AddInt64(&s.metrics.PacketsDecoded, 1)
-		s.metrics.PacketsDecoded++
+		if filter != nil && !filter.Match(lwe) {
+			s.sink.count(&s.metrics.PacketsFiltered, "packets_filtered", 1)
+			continue
+		}
 
 		select {
 		case s.lwesChan <- lwe:
-			// atomic.AddInt64(&s.metrics.PacketsDecodedPassed, 1)
-			s.metrics.PacketsDecodedPassed++
-			s.metricsLock.Unlock()
+			s.sink.count(&s.metrics.PacketsDecodedPassed, "packets_decoded_passed", 1)
 			lwe = new(LwesEvent)
 		default:
-			// atomic.AddInt64(&s.metrics.PacketsDroppedDecoded, 1)
-			s.metrics.PacketsDroppedDecoded++
-			s.metricsLock.Unlock()
+			s.sink.count(&s.metrics.PacketsDroppedDecoded, "packets_dropped_decoded", 1)
 		}
 	}
 	// log.Printf("worker%d end\n", idx)
@@ -307,25 +380,38 @@ func (s *bufferedServer) lwesdecoder(idx int, dataChan <-chan *readBuf) {
 	s.waitworkers.Done()
 }
 
+// EnableMetricsReport polls a snapshot of the metrics every interval
+// until the server is stopped; SetMetricsSink pushes them instead
 func (s *bufferedServer) EnableMetricsReport(interval time.Duration, reportFunc func(string, interface{})) {
-	s.reportIntv = interval
-	s.reportFunc = reportFunc
+	if interval == 0 {
+		return
+	}
 
-	if interval != 0 {
-		s.tick = time.NewTicker(interval)
-		go func() {
-			for range s.tick.C {
+	go func() {
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
 				// log.Println("reporting metrics")
-				s.metricsLock.RLock()
-				metrics := s.metrics
-				s.metricsLock.RUnlock()
-
-				reportFunc("lwes-events", metrics)
+				s.reportMetrics(reportFunc)
+			case <-s.waitstop:
+				return
 			}
-		}()
-	}
+		}
+	}()
+}
+
+// SetMetricsSink pushes the updates of the metrics to the sink
+func (s *bufferedServer) SetMetricsSink(sink MetricsSink) {
+	s.sink.use(sink)
+}
+
+// reportMetrics reports a snapshot of the metrics as "lwes-events"
+func (s *bufferedServer) reportMetrics(reportFunc func(string, interface{})) {
+	reportFunc("lwes-events", snapshotMetrics(&s.metrics))
 }
 
 func (s *bufferedServer) Addr() net.Addr {
-	return s.transport.LocalAddr()
+	return s.addr
 }
@@ -84,6 +84,14 @@ func writeKey(buf []byte, key string) ([]byte, error) {
 	return writeLengthStr(buf, 1, 255, key)
 }
 
+// the keys of the attributes of the receipt of an event, set by
+// the receivers like the C listeners and the journal readers
+const (
+	ReceiptTimeKey = "ReceiptTime" // int64, in milliseconds since the epoch
+	SenderIPKey    = "SenderIP"    // net.IP
+	SenderPortKey  = "SenderPort"  // uint16
+)
+
 type LwesEvent struct {
 	Name  string                 // the event name
 	Attrs map[string]interface{} // the attrs in a map
@@ -101,9 +109,12 @@ func NewLwesEvent(name string) *LwesEvent {
 	}
 }
 
-// use NewLwesEvent and Set for events to be encoded
+// use NewLwesEvent and Set for events to be encoded; setting a key
+// again replaces its value, keeping its order
 func (lwe *LwesEvent) Set(key string, value interface{}) {
-	lwe.attr_keys = append(lwe.attr_keys, key)
+	if _, ok := lwe.Attrs[key]; !ok {
+		lwe.attr_keys = append(lwe.attr_keys, key)
+	}
 	lwe.Attrs[key] = value
 }
 
@@ -138,45 +149,51 @@ func (lwe *LwesEvent) Size() int {
 	//  each key is a byte length prefixed string (<=255 bytes)
 	//  each value is a byte tag prefix as value type, followed by the value
 	for key, value := range lwe.Attrs {
-		s += 1 + len(key)
-		switch v := value.(type) {
-		case uint16:
-			s += 1 + 2
-		case int16:
-			s += 1 + 2
-		case uint32:
-			s += 1 + 4
-		case int32:
-			s += 1 + 4
-		case uint64:
-			s += 1 + 8
-		case int64:
-			s += 1 + 8
-		case string:
-			l := len(v)
-			if l <= 65535 {
-				s += 1 + 2 + l // short string
-			} else {
-				s += 1 + 4 + l // long string
-			}
-		case net.IP:
-			s += 1 + 4
-		case bool:
-			s += 1 + 1
-		case byte:
-			s += 1 + 1
-		case float32:
-			s += 1 + 4
-		case float64:
-			s += 1 + 8
-		default:
-			// unknown data type
-		}
+		s += attrSize(key, value)
 	}
 
 	return s
 }
 
+// the encoded size of a single key, value pair
+func attrSize(key string, value interface{}) int {
+	s := 1 + len(key)
+	switch v := value.(type) {
+	case uint16:
+		s += 1 + 2
+	case int16:
+		s += 1 + 2
+	case uint32:
+		s += 1 + 4
+	case int32:
+		s += 1 + 4
+	case uint64:
+		s += 1 + 8
+	case int64:
+		s += 1 + 8
+	case string:
+		l := len(v)
+		if l <= 65535 {
+			s += 1 + 2 + l // short string
+		} else {
+			s += 1 + 4 + l // long string
+		}
+	case net.IP:
+		s += 1 + 4
+	case bool:
+		s += 1 + 1
+	case byte:
+		s += 1 + 1
+	case float32:
+		s += 1 + 4
+	case float64:
+		s += 1 + 8
+	default:
+		// unknown data type
+	}
+	return s
+}
+
 // MarshalBinary implements the encoding.BinaryMarshaler interface.
 func (lwe *LwesEvent) MarshalBinary() (buf []byte, err error) {
 	buf = make([]byte, 0, lwe.Size())
@@ -228,7 +245,7 @@ func (lwe *LwesEvent) MarshalBinary() (buf []byte, err error) {
 				binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(l))
 			} else if l <= 4294967295 /* 0xffffffff, or max of uint32 */ {
 				buf = append(buf, LWES_TYPE_LONG_STRING)
-				buf = buf[0 : len(buf)+2]
+				buf = buf[0 : len(buf)+4]
 				binary.BigEndian.PutUint32(buf[len(buf)-4:], uint32(l))
 			} else {
 				return nil, errNameTooLong
@@ -273,6 +290,27 @@ func (lwe *LwesEvent) UnmarshalBinary(data []byte) error {
 	return parse(data, lwe)
 }
 
+// PeekName returns the name of an encoded event without decoding its
+// attrs, for skipping the events of the names not wanted cheaply
+func PeekName(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", io.EOF
+	}
+	name, ok := nameBytes(data)
+	if !ok {
+		return "", fmt.Errorf("Unexpected end of msg with remaining: %d bytes from total len: %d", len(data)-1, len(data))
+	}
+	return string(name), nil
+}
+
+// nameBytes returns the bytes of the name of an encoded event
+func nameBytes(data []byte) ([]byte, bool) {
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return nil, false
+	}
+	return data[1 : 1+int(data[0])], true
+}
+
 // Decode a bytes buffer into a LwesEvent
 func parse(buf []byte, lwe *LwesEvent) error {
 	// off, tlen := 0, len(buf)
@@ -441,6 +479,38 @@ func parse(buf []byte, lwe *LwesEvent) error {
 
 			// convert to bool: 0 is false; otherwise true
 			value = (b != 0x00)
+
+		case LWES_TYPE_BYTE: // case 10
+			b, err = r.ReadByte()
+			if err != nil {
+				return err
+			}
+			value = b
+
+		case LWES_TYPE_FLOAT: // case 11
+			const readLen = 4
+			if r.Len() < readLen {
+				return fmt.Errorf("Unexpected end of msg with remaining: %d bytes from total len: %d", r.Len(), len(buf))
+			}
+			value = math.Float32frombits(binary.BigEndian.Uint32(r.Next(readLen)))
+
+		case LWES_TYPE_DOUBLE: // case 12
+			const readLen = 8
+			if r.Len() < readLen {
+				return fmt.Errorf("Unexpected end of msg with remaining: %d bytes from total len: %d", r.Len(), len(buf))
+			}
+			value = math.Float64frombits(binary.BigEndian.Uint64(r.Next(readLen)))
+
+		case LWES_TYPE_LONG_STRING: // case 13: a uint32 length prefixed string
+			const readLen = 4
+			if r.Len() < readLen {
+				return fmt.Errorf("Unexpected end of msg with remaining: %d bytes from total len: %d", r.Len(), len(buf))
+			}
+			blen := binary.BigEndian.Uint32(r.Next(readLen))
+			if uint32(r.Len()) < blen {
+				return fmt.Errorf("Unexpected end of msg with remaining: %d bytes from total len: %d", r.Len(), len(buf))
+			}
+			value = string(r.Next(int(blen)))
 		}
 
 		lwe.attr_keys = append(lwe.attr_keys, key)
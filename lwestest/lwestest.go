@@ -0,0 +1,213 @@
+// Package lwestest provides an in-process lwes bus for hermetic tests:
+// emitters and a server wired together over an in-memory pipe, without
+// any network, with injectable packet loss, reordering and corruption.
+//
+//	bus := lwestest.NewBus(lwestest.Config{})
+//	defer bus.Close()
+//
+//	em := bus.Emitter()
+//	em.Emit(lwe)
+//
+//	bus.ExpectEvent(t, "MonDemand::StatsMsg", map[string]interface{}{"num": uint16(1)})
+package lwestest
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go"
+)
+
+const (
+	defaultQueueSize = 1000
+	defaultTimeout   = time.Second
+)
+
+// Config of the faults injected on the bus; each of the rates is a
+// probability between 0 and 1 applied to every packet, drawn from a
+// random source seeded by Seed so a test run is repeatable
+type Config struct {
+	Seed    int64
+	Loss    float64 // drop the packet
+	Reorder float64 // hold the packet back and deliver it after the next one
+	Corrupt float64 // flip a random bit of the packet
+
+	QueueSize int           // max packets in flight, default 1000
+	Timeout   time.Duration // how long ExpectEvent waits, default 1s
+}
+
+// Bus connects any number of emitters to a single server
+type Bus struct {
+	cfg       Config
+	transport lwes.Transport
+	server    lwes.Server
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+	held  []byte // the packet held back for reordering
+
+	events <-chan *lwes.LwesEvent
+}
+
+// NewBus returns a bus serving with the real server of the lwes package
+func NewBus(cfg Config) *Bus {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	transport, src := lwes.NewPipe(cfg.QueueSize)
+	return &Bus{
+		cfg:       cfg,
+		transport: transport,
+		server:    lwes.NewServer(src),
+		rand:      rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// Server returns the server receiving all the events sent on the bus
+func (b *Bus) Server() lwes.Server {
+	return b.server
+}
+
+// Emitter returns a new emitter sending to the bus; closing it
+// leaves the bus open
+func (b *Bus) Emitter() *lwes.Emitter {
+	return lwes.NewEmitter(busTransport{b})
+}
+
+// Close ends the bus after delivering the packets in flight, then
+// the server stops by itself
+func (b *Bus) Close() {
+	b.mutex.Lock()
+	if b.held != nil {
+		b.transport.Write(b.held)
+		b.held = nil
+	}
+	b.mutex.Unlock()
+
+	// the decoder workers consume the queue for the server to stop
+	b.Events()
+	b.transport.Close()
+	b.server.Wait()
+}
+
+// send one packet with the configured faults
+func (b *Bus) send(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.rand.Float64() < b.cfg.Loss {
+		return len(p), nil
+	}
+
+	if b.rand.Float64() < b.cfg.Corrupt && len(p) > 0 {
+		p = append([]byte(nil), p...)
+		p[b.rand.Intn(len(p))] ^= 1 << uint(b.rand.Intn(8))
+	}
+
+	if b.held == nil && b.rand.Float64() < b.cfg.Reorder {
+		b.held = append([]byte(nil), p...)
+		return len(p), nil
+	}
+
+	if _, err := b.transport.Write(p); err != nil {
+		return 0, err
+	}
+	if b.held != nil {
+		held := b.held
+		b.held = nil
+		if _, err := b.transport.Write(held); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+type busTransport struct{ *Bus }
+
+func (t busTransport) Write(p []byte) (int, error) { return t.send(p) }
+func (t busTransport) Close() error                { return nil }
+func (t busTransport) MaxEventSize() int           { return t.transport.MaxEventSize() }
+
+// Events returns the decoded events of the server in the order they
+// are sent, decoded by a single worker
+func (b *Bus) Events() <-chan *lwes.LwesEvent {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.events == nil {
+		b.events = b.server.WaitLwesMode(1)
+	}
+	return b.events
+}
+
+// NextEvent returns the next decoded event, or nil if none is received
+// within the timeout or the bus is closed
+func (b *Bus) NextEvent() *lwes.LwesEvent {
+	select {
+	case lwe := <-b.Events():
+		return lwe
+	case <-time.After(b.cfg.Timeout):
+		return nil
+	}
+}
+
+// ExpectEvent fails the test unless the next event has the name and
+// at least the attrs given
+func (b *Bus) ExpectEvent(t testing.TB, name string, attrs map[string]interface{}) *lwes.LwesEvent {
+	t.Helper()
+
+	lwe := b.NextEvent()
+	if lwe == nil {
+		t.Fatalf("expected event %s, but received none in %s", name, b.cfg.Timeout)
+		return nil
+	}
+	if err := Match(lwe, name, attrs); err != nil {
+		t.Fatal(err)
+	}
+	return lwe
+}
+
+// ExpectNoEvent fails the test if any event is received within d
+func (b *Bus) ExpectNoEvent(t testing.TB, d time.Duration) {
+	t.Helper()
+
+	select {
+	case lwe, ok := <-b.Events():
+		if ok {
+			t.Fatalf("expected no event, but received %s%v", lwe.Name, lwe.Attrs)
+		}
+	case <-time.After(d):
+	}
+}
+
+// Match returns an error describing the first difference of the
+// event from the name and the attrs; extra attributes are ignored
+func Match(lwe *lwes.LwesEvent, name string, attrs map[string]interface{}) error {
+	if lwe.Name != name {
+		return fmt.Errorf("expected event %s, but got %s", name, lwe.Name)
+	}
+	for key, want := range attrs {
+		got, ok := lwe.Attrs[key]
+		if !ok {
+			return fmt.Errorf("expected %s.%s = %v (%T), but it's missing", name, key, want, want)
+		}
+		if ip, ok := want.(net.IP); ok {
+			if gotIP, ok := got.(net.IP); ok && ip.Equal(gotIP) {
+				continue
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("expected %s.%s = %v (%T), but got %v (%T)", name, key, want, want, got, got)
+		}
+	}
+	return nil
+}
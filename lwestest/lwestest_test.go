@@ -0,0 +1,79 @@
+package lwestest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/lwestest"
+)
+
+func newEvent(seq int64) *lwes.LwesEvent {
+	lwe := lwes.NewLwesEvent("Test::Event")
+	lwe.Set("seq", seq)
+	return lwe
+}
+
+func TestBus(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	em := bus.Emitter()
+	for i := int64(0); i < 10; i++ {
+		em.Emit(newEvent(i))
+	}
+	for i := int64(0); i < 10; i++ {
+		bus.ExpectEvent(t, "Test::Event", map[string]interface{}{"seq": i})
+	}
+	bus.ExpectNoEvent(t, 10*time.Millisecond)
+}
+
+func TestBusFaults(t *testing.T) {
+	const total = 1000
+	bus := lwestest.NewBus(lwestest.Config{Seed: 1, Loss: 0.1, Reorder: 0.1, Corrupt: 0.1, Timeout: 100 * time.Millisecond})
+	defer bus.Close()
+
+	em := bus.Emitter()
+	for i := int64(0); i < total; i++ {
+		em.Emit(newEvent(i))
+	}
+
+	received, reordered := 0, 0
+	last := int64(-1)
+	for lwe := bus.NextEvent(); lwe != nil; lwe = bus.NextEvent() {
+		if lwe.Name != "Test::Event" {
+			// a corrupted name still decodes
+			continue
+		}
+		if seq, ok := lwe.Attrs["seq"].(int64); ok {
+			if seq < last {
+				reordered++
+			}
+			last = seq
+		}
+		received++
+		if received == total {
+			break
+		}
+	}
+	// about 80%, less the lost and the corrupted ones
+	if received < total*70/100 || received > total*90/100 {
+		t.Fatalf("expected 70%% to 90%% of %d events received, got %d", total, received)
+	}
+	if reordered == 0 {
+		t.Fatal("expected some events reordered")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	lwe := newEvent(1)
+	if err := lwestest.Match(lwe, "Test::Event", map[string]interface{}{"seq": int64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lwestest.Match(lwe, "Test::Event", map[string]interface{}{"seq": 1}); err == nil {
+		t.Fatal("expected a type mismatch")
+	}
+	if err := lwestest.Match(lwe, "Test::Event", map[string]interface{}{"missing": "x"}); err == nil {
+		t.Fatal("expected a missing attribute")
+	}
+}
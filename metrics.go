@@ -0,0 +1,88 @@
+package lwes
+
+import (
+	"expvar"
+	"reflect"
+	"sync/atomic"
+)
+
+// MetricsSink receives the metrics of the servers and the emitters as
+// they are updated, by the key of their mondemand_stat tag, like
+// "packets_received"; it must be safe for concurrent use
+type MetricsSink interface {
+	Add(name string, delta int64) // to a counter
+	Set(name string, value int64) // a gauge
+}
+
+type nopSink struct{}
+
+func (nopSink) Add(string, int64) {}
+func (nopSink) Set(string, int64) {}
+
+// NopSink discards the metrics, the default sink
+var NopSink MetricsSink = nopSink{}
+
+type expvarSink struct {
+	m *expvar.Map
+}
+
+// NewExpvarSink publishes the metrics as the *expvar.Int values of the
+// map, like the one of expvar.NewMap("lwes")
+func NewExpvarSink(m *expvar.Map) MetricsSink {
+	return expvarSink{m}
+}
+
+func (s expvarSink) Add(name string, delta int64) {
+	s.m.Add(name, delta)
+}
+
+func (s expvarSink) Set(name string, value int64) {
+	if v, ok := s.m.Get(name).(*expvar.Int); ok {
+		v.Set(value)
+		return
+	}
+	// Add creates the *expvar.Int at most once
+	s.m.Add(name, 0)
+	s.m.Get(name).(*expvar.Int).Set(value)
+}
+
+type sinkBox struct{ MetricsSink }
+
+// sinkRef keeps the tagged int64 fields of a metrics struct updated
+// atomically, and pushes each update to the sink, which may be replaced
+// while in use; the zero value pushes to nothing
+type sinkRef struct {
+	v atomic.Value // sinkBox
+}
+
+func (r *sinkRef) use(sink MetricsSink) {
+	if sink == nil {
+		sink = NopSink
+	}
+	r.v.Store(sinkBox{sink})
+}
+
+func (r *sinkRef) count(p *int64, name string, delta int64) {
+	atomic.AddInt64(p, delta)
+	if b, ok := r.v.Load().(sinkBox); ok {
+		b.Add(name, delta)
+	}
+}
+
+func (r *sinkRef) gauge(p *int64, name string, value int64) {
+	atomic.StoreInt64(p, value)
+	if b, ok := r.v.Load().(sinkBox); ok {
+		b.Set(name, value)
+	}
+}
+
+// snapshotMetrics copies a metrics struct of int64 fields updated
+// atomically
+func snapshotMetrics[T any](p *T) T {
+	var snap T
+	src, dst := reflect.ValueOf(p).Elem(), reflect.ValueOf(&snap).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		dst.Field(i).SetInt(atomic.LoadInt64(src.Field(i).Addr().Interface().(*int64)))
+	}
+	return snap
+}
@@ -0,0 +1,130 @@
+package lwes
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpvarSink(t *testing.T) {
+	tr, src := NewPipe(10)
+	server := NewServer(src)
+	m := new(expvar.Map).Init()
+	server.(MetricsSinkSetter).SetMetricsSink(NewExpvarSink(m))
+	out := server.WaitLwesMode(1)
+	defer server.Stop()
+
+	em := NewEmitter(tr)
+	em.SetMetricsSink(NewExpvarSink(m))
+	const total = 3
+	for i := 0; i < total; i++ {
+		em.Emit(NewLwesEvent("Test::Event"))
+	}
+	for i := 0; i < total; i++ {
+		select {
+		case <-out:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received only %d of %d events", i, total)
+		}
+	}
+
+	for name, want := range map[string]int64{
+		"events_emitted":         total,
+		"packets_received":       total,
+		"packets_decoded_passed": total,
+		"packet_size":            int64(NewLwesEvent("Test::Event").Size()),
+	} {
+		v, ok := m.Get(name).(*expvar.Int)
+		if !ok || v.Value() != want {
+			t.Fatalf("got %s = %v, want %d", name, m.Get(name), want)
+		}
+	}
+	if got := em.Metrics().EventsEmitted; got != total {
+		t.Fatalf("got %d events emitted in the snapshot, want %d", got, total)
+	}
+}
+
+// runWorkers splits b.N calls of work among the workers
+func runWorkers(b *testing.B, workers int, work func(w int)) {
+	var wg sync.WaitGroup
+	per := b.N/workers + 1
+	b.ResetTimer()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < per; i++ {
+				work(w)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// the counters updated for each packet decoded, by the former mutex
+// guarded struct and by atomics on the shared struct
+func BenchmarkDecoderMetrics(b *testing.B) {
+	type counters struct{ decoded, decodedPassed int64 }
+	for _, workers := range []int{12, 24} {
+		b.Run(fmt.Sprintf("mutex/workers=%d", workers), func(b *testing.B) {
+			var mu sync.Mutex
+			var m counters
+			runWorkers(b, workers, func(int) {
+				mu.Lock()
+				m.decoded++
+				mu.Unlock()
+				mu.Lock()
+				m.decodedPassed++
+				mu.Unlock()
+			})
+		})
+		b.Run(fmt.Sprintf("shared/workers=%d", workers), func(b *testing.B) {
+			var s sinkRef
+			var m counters
+			runWorkers(b, workers, func(int) {
+				s.count(&m.decoded, "packets_decoded", 1)
+				s.count(&m.decodedPassed, "packets_decoded_passed", 1)
+			})
+		})
+	}
+}
+
+// the decoding of the server with 12 workers, as in the perfmsg listener
+func BenchmarkServerDecoders(b *testing.B) {
+	lwe := NewLwesEvent("MonDemand::PerfMsg")
+	lwe.Set("id", "0db302ef-4ba1-4d6b-86e3-92793d4b0c9e")
+	lwe.Set("num", uint16(1))
+	lwe.Set("label0", "adunit:538494050:call:1:ssrtb")
+	lwe.Set("start0", int64(1494880081332))
+	lwe.Set("end0", int64(1494880081487))
+	event, err := Marshal(lwe)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	s := newBufferedServer("bench", make(chan *readBuf, 1024), MAX_PACKET_SIZE)
+	out := s.WaitLwesMode(12)
+	consumed := make(chan struct{})
+	go func() {
+		for range out {
+		}
+		close(consumed)
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rbuf := NewFixedBuffer(&s.readBufPool, s.maxPacketSize)
+		rbuf.n = copy(rbuf.buf, event)
+		s.datawait.Add(1)
+		rbuf.wait = &s.datawait
+		s.dataChan <- rbuf
+	}
+	close(s.dataChan)
+	s.waitworkers.Wait()
+	b.StopTimer()
+
+	close(s.lwesChan)
+	<-consumed
+}
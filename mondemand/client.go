@@ -0,0 +1,413 @@
+package mondemand
+
+import (
+	"container/list"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lwes/lwes-go"
+)
+
+// the updates of a metric sent to the client
+const (
+	opIncrement = iota
+	opSetCounter
+	opSetGauge
+	opObserve
+)
+
+type update struct {
+	op    int
+	key   string
+	value int64
+	ctxt  *metricContext // nil for the metrics without their own context
+}
+
+// metricContext is the context of the metrics of a Scope
+type metricContext struct {
+	encoded string // the key of the context in the client
+	pairs   []KeyValue
+}
+
+type metrickey struct {
+	typ, key string
+	context  string // encoded context
+}
+
+// series is the aggregated value of a metric in its context
+type series struct {
+	Metric
+	ctxt       *metricContext
+	seq        uint64 // the creation order
+	lastUpdate time.Time
+	elem       *list.Element // in the lru, most recently updated first
+}
+
+// statsetkey is the key of a statset in its context
+type statsetkey struct {
+	key, context string
+}
+
+// ClientConfig configures a Client; zero values mean the defaults
+type ClientConfig struct {
+	ProgID string
+	// Interval of the emits; 0 or less emits on Flush and Close only
+	Interval time.Duration
+
+	// Percentiles of the statsets, default 75, 90, 95, 98 and 99
+	Percentiles []float64
+	// ReservoirSize is the max values sampled per statset and interval
+	// for the median and the percentiles, default 1024
+	ReservoirSize int
+
+	// MaxSeries bounds the counters and gauges kept, by evicting the
+	// least recently updated one; 0 for unbounded
+	MaxSeries int
+	// SeriesTTL evicts the counters and gauges not updated for this
+	// long at the next flush; 0 to keep them forever
+	SeriesTTL time.Duration
+}
+
+// Client aggregates the stats of a program and emits them as
+// a MonDemand::StatsMsg every interval: the counters keep counting
+// across the intervals, the gauges keep the last value set, and the
+// statsets sample the values observed in each interval.
+// The metrics of a Scope are emitted in a StatsMsg of their own context.
+type Client struct {
+	emitter *lwes.Emitter
+	cfg     ClientConfig
+
+	updates  chan update
+	contextc chan KeyValue
+	flushc   chan chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	closing  sync.Once
+
+	// owned by the serve goroutine
+	context []KeyValue
+	statsdb map[metrickey]*series
+	lru     *list.List
+	seq     uint64
+	now     func() time.Time
+
+	statsets    map[statsetkey]*statset
+	statsetKeys []statsetkey
+	statsetCtxt map[string]*metricContext
+	rand        *rand.Rand
+}
+
+// NewClient starts a client emitting the stats of progID through the
+// emitter every interval, or on Flush and Close only if the interval
+// is 0; the emitter is still owned by the caller
+func NewClient(progID string, interval time.Duration, em *lwes.Emitter) *Client {
+	return NewClientWithConfig(ClientConfig{ProgID: progID, Interval: interval}, em)
+}
+
+// NewClientWithConfig starts a client like NewClient with the cfg
+func NewClientWithConfig(cfg ClientConfig, em *lwes.Emitter) *Client {
+	c := newClient(cfg, em)
+
+	go c.serve()
+
+	return c
+}
+
+func newClient(cfg ClientConfig, em *lwes.Emitter) *Client {
+	if cfg.Percentiles == nil {
+		cfg.Percentiles = defaultPercentiles
+	}
+	if cfg.ReservoirSize <= 0 {
+		cfg.ReservoirSize = defaultReservoirSize
+	}
+
+	return &Client{
+		emitter:     em,
+		cfg:         cfg,
+		updates:     make(chan update, 100),
+		contextc:    make(chan KeyValue, 10),
+		flushc:      make(chan chan struct{}),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		statsdb:     make(map[metrickey]*series),
+		lru:         list.New(),
+		now:         time.Now,
+		statsets:    make(map[statsetkey]*statset),
+		statsetCtxt: make(map[string]*metricContext),
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (c *Client) serve() {
+	defer close(c.stopped)
+
+	var tick <-chan time.Time
+	if c.cfg.Interval > 0 {
+		ticker := time.NewTicker(c.cfg.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case u := <-c.updates:
+			c.apply(u)
+		case kv := <-c.contextc:
+			c.context = append(c.context, kv)
+		case flushed := <-c.flushc:
+			c.drain()
+			c.flush()
+			close(flushed)
+		case <-tick:
+			c.drain()
+			c.flush()
+		case <-c.done:
+			c.drain()
+			c.flush()
+			return
+		}
+	}
+}
+
+// drain applies the updates already sent, so a flush includes them
+func (c *Client) drain() {
+	for {
+		select {
+		case u := <-c.updates:
+			c.apply(u)
+		case kv := <-c.contextc:
+			c.context = append(c.context, kv)
+		default:
+			return
+		}
+	}
+}
+
+func (c *Client) apply(u update) {
+	var encoded string
+	if u.ctxt != nil {
+		encoded = u.ctxt.encoded
+	}
+
+	if u.op == opObserve {
+		sk := statsetkey{u.key, encoded}
+		s, ok := c.statsets[sk]
+		if !ok {
+			s = &statset{}
+			c.statsets[sk] = s
+			c.statsetKeys = append(c.statsetKeys, sk)
+			c.statsetCtxt[encoded] = u.ctxt
+		}
+		s.observe(u.value, c.cfg.ReservoirSize, c.rand)
+		return
+	}
+
+	typ := Counter
+	if u.op == opSetGauge {
+		typ = Gauge
+	}
+
+	mk := metrickey{typ, u.key, encoded}
+	m, ok := c.statsdb[mk]
+	if !ok {
+		if c.cfg.MaxSeries > 0 && len(c.statsdb) >= c.cfg.MaxSeries {
+			c.evict(c.lru.Back().Value.(metrickey))
+		}
+		c.seq++
+		m = &series{Metric: Metric{Type: typ, Key: u.key}, ctxt: u.ctxt, seq: c.seq}
+		m.elem = c.lru.PushFront(mk)
+		c.statsdb[mk] = m
+	} else {
+		c.lru.MoveToFront(m.elem)
+	}
+	m.lastUpdate = c.now()
+
+	switch u.op {
+	case opIncrement:
+		m.Value += u.value
+	case opSetCounter, opSetGauge:
+		m.Value = u.value
+	}
+}
+
+func (c *Client) evict(mk metrickey) {
+	c.lru.Remove(c.statsdb[mk].elem)
+	delete(c.statsdb, mk)
+}
+
+// expire evicts the series not updated within the ttl
+func (c *Client) expire() {
+	if c.cfg.SeriesTTL <= 0 {
+		return
+	}
+	deadline := c.now().Add(-c.cfg.SeriesTTL)
+	for e := c.lru.Back(); e != nil; e = c.lru.Back() {
+		mk := e.Value.(metrickey)
+		if !c.statsdb[mk].lastUpdate.Before(deadline) {
+			break
+		}
+		c.evict(mk)
+	}
+}
+
+// contextGroup is the metrics of a StatsMsg: one per distinct context
+type contextGroup struct {
+	ctxt    *metricContext
+	seq     uint64 // the first series in the group
+	series  []*series
+	metrics []Metric
+}
+
+func (c *Client) flush() {
+	c.expire()
+
+	if len(c.statsdb) == 0 && len(c.statsets) == 0 {
+		return
+	}
+
+	groups := make(map[string]*contextGroup)
+	group := func(encoded string, ctxt *metricContext, seq uint64) *contextGroup {
+		g, ok := groups[encoded]
+		if !ok {
+			g = &contextGroup{ctxt: ctxt, seq: seq}
+			groups[encoded] = g
+		}
+		if seq < g.seq {
+			g.seq = seq
+		}
+		return g
+	}
+
+	for mk, m := range c.statsdb {
+		g := group(mk.context, m.ctxt, m.seq)
+		g.series = append(g.series, m)
+	}
+	for _, g := range groups {
+		sort.Slice(g.series, func(i, j int) bool { return g.series[i].seq < g.series[j].seq })
+		for _, m := range g.series {
+			g.metrics = append(g.metrics, m.Metric)
+		}
+	}
+
+	// the statsets start over every interval
+	for _, sk := range c.statsetKeys {
+		g := group(sk.context, c.statsetCtxt[sk.context], c.seq+1)
+		g.metrics = append(g.metrics, c.statsets[sk].metrics(sk.key, c.cfg.Percentiles)...)
+	}
+	c.statsets = make(map[statsetkey]*statset)
+	c.statsetKeys = nil
+	c.statsetCtxt = make(map[string]*metricContext)
+
+	sorted := make([]*contextGroup, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].seq < sorted[j].seq })
+
+	for _, g := range sorted {
+		st := NewStatsMsg(c.cfg.ProgID)
+		st.Context = c.context
+		if g.ctxt != nil {
+			st.Context = append(append([]KeyValue(nil), c.context...), g.ctxt.pairs...)
+		}
+		st.Metrics = g.metrics
+		if err := c.emitter.Emit(st.ToLwes()); err != nil {
+			log.Printf("failed to emit the stats of %s: %v\n", c.cfg.ProgID, err)
+		}
+	}
+}
+
+func (c *Client) send(u update) {
+	select {
+	case c.updates <- u:
+	case <-c.done:
+	}
+}
+
+// counters
+func (c *Client) Increment(key string, value int64) {
+	c.send(update{opIncrement, key, value, nil})
+}
+
+func (c *Client) SetCounter(key string, value int64) {
+	c.send(update{opSetCounter, key, value, nil})
+}
+
+// for gauges
+func (c *Client) SetGauge(key string, value int64) {
+	c.send(update{opSetGauge, key, value, nil})
+}
+
+// Observe a value sampled into the statset of the key, like a latency
+func (c *Client) Observe(key string, value int64) {
+	c.send(update{opObserve, key, value, nil})
+}
+
+// AddContext adds a key, value pair to the context of all the stats
+func (c *Client) AddContext(key, value string) {
+	select {
+	case c.contextc <- KeyValue{key, value}:
+	case <-c.done:
+	}
+}
+
+// Scope is a view of the client for the metrics of their own context,
+// like an endpoint or a customer, added to the context of the client
+type Scope struct {
+	client *Client
+	ctxt   *metricContext
+}
+
+// WithContext returns a Scope for the metrics in the context of the
+// key, value pairs; the scopes of the same pairs in the same order
+// share their metrics
+func (c *Client) WithContext(pairs ...KeyValue) *Scope {
+	var sb strings.Builder
+	for _, kv := range pairs {
+		sb.WriteString(kv.Key)
+		sb.WriteByte(0)
+		sb.WriteString(kv.Value)
+		sb.WriteByte(0)
+	}
+	return &Scope{
+		client: c,
+		ctxt:   &metricContext{encoded: sb.String(), pairs: append([]KeyValue(nil), pairs...)},
+	}
+}
+
+func (s *Scope) Increment(key string, value int64) {
+	s.client.send(update{opIncrement, key, value, s.ctxt})
+}
+
+func (s *Scope) SetCounter(key string, value int64) {
+	s.client.send(update{opSetCounter, key, value, s.ctxt})
+}
+
+func (s *Scope) SetGauge(key string, value int64) {
+	s.client.send(update{opSetGauge, key, value, s.ctxt})
+}
+
+func (s *Scope) Observe(key string, value int64) {
+	s.client.send(update{opObserve, key, value, s.ctxt})
+}
+
+// Flush emits the stats now, and returns after they are emitted
+func (c *Client) Flush() {
+	flushed := make(chan struct{})
+	select {
+	case c.flushc <- flushed:
+		<-flushed
+	case <-c.done:
+	}
+}
+
+// Close flushes the stats and stops the client; the updates after
+// Close are ignored
+func (c *Client) Close() {
+	c.closing.Do(func() { close(c.done) })
+	<-c.stopped
+}
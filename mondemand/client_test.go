@@ -0,0 +1,154 @@
+package mondemand
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go/lwestest"
+)
+
+func TestClient(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	em := bus.Emitter()
+	c := NewClient("lwes-test", time.Hour, em)
+	c.AddContext("host", "localhost")
+	c.Increment("requests", 1)
+	c.Increment("requests", 2)
+	c.SetGauge("connections", 5)
+	c.SetGauge("connections", 7)
+	c.Flush()
+
+	st, err := DecodeStatsMsg(bus.ExpectEvent(t, StatsMsgName, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Metric{{Counter, "requests", 3}, {Gauge, "connections", 7}}
+	if len(st.Metrics) != 2 || st.Metrics[0] != want[0] || st.Metrics[1] != want[1] {
+		t.Fatalf("got metrics %v, want %v", st.Metrics, want)
+	}
+	if len(st.Context) != 1 || st.Context[0] != (KeyValue{"host", "localhost"}) {
+		t.Fatalf("unexpected context %v", st.Context)
+	}
+
+	// counters keep counting, and Close flushes
+	c.Increment("requests", 1)
+	c.Close()
+	st, err = DecodeStatsMsg(bus.ExpectEvent(t, StatsMsgName, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Metrics[0] != (Metric{Counter, "requests", 4}) {
+		t.Fatalf("unexpected metric %v after Close", st.Metrics[0])
+	}
+
+	// no-op after Close
+	c.Increment("requests", 1)
+	c.Flush()
+	bus.ExpectNoEvent(t, 10*time.Millisecond)
+}
+
+func TestClientScopes(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	c := NewClient("lwes-test", time.Hour, bus.Emitter())
+	defer c.Close()
+
+	c.AddContext("host", "localhost")
+	c.Increment("requests", 1)
+	c.WithContext(KeyValue{"endpoint", "/a"}).Increment("requests", 2)
+	c.WithContext(KeyValue{"endpoint", "/b"}).SetGauge("inflight", 3)
+	c.WithContext(KeyValue{"endpoint", "/a"}).Increment("requests", 4)
+	c.Flush()
+
+	want := []struct {
+		context []KeyValue
+		metric  Metric
+	}{
+		{[]KeyValue{{"host", "localhost"}}, Metric{Counter, "requests", 1}},
+		{[]KeyValue{{"host", "localhost"}, {"endpoint", "/a"}}, Metric{Counter, "requests", 6}},
+		{[]KeyValue{{"host", "localhost"}, {"endpoint", "/b"}}, Metric{Gauge, "inflight", 3}},
+	}
+	for _, w := range want {
+		st, err := DecodeStatsMsg(bus.ExpectEvent(t, StatsMsgName, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(st.Metrics) != 1 || st.Metrics[0] != w.metric {
+			t.Fatalf("got metrics %v, want %v", st.Metrics, w.metric)
+		}
+		if len(st.Context) != len(w.context) {
+			t.Fatalf("got context %v, want %v", st.Context, w.context)
+		}
+		for i := range w.context {
+			if st.Context[i] != w.context[i] {
+				t.Fatalf("got context %v, want %v", st.Context, w.context)
+			}
+		}
+	}
+}
+
+func TestClientEviction(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	now := time.Unix(1000, 0)
+	c := newClient(ClientConfig{ProgID: "lwes-test", MaxSeries: 2, SeriesTTL: time.Minute}, bus.Emitter())
+	c.now = func() time.Time { return now }
+
+	counters := func() map[string]int64 {
+		c.flush()
+		st, err := DecodeStatsMsg(bus.ExpectEvent(t, StatsMsgName, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]int64)
+		for _, m := range st.Metrics {
+			got[m.Key] = m.Value
+		}
+		return got
+	}
+
+	// the least recently updated series is evicted on insert
+	c.apply(update{opIncrement, "a", 1, nil})
+	c.apply(update{opIncrement, "b", 1, nil})
+	c.apply(update{opIncrement, "a", 1, nil})
+	c.apply(update{opIncrement, "c", 1, nil})
+	got := counters()
+	if len(got) != 2 || got["a"] != 2 || got["c"] != 1 {
+		t.Fatalf("unexpected counters %v after eviction", got)
+	}
+
+	// the series not updated within the ttl expire at the flush
+	now = now.Add(45 * time.Second)
+	c.apply(update{opIncrement, "c", 1, nil})
+	now = now.Add(30 * time.Second)
+	got = counters()
+	if len(got) != 1 || got["c"] != 2 {
+		t.Fatalf("unexpected counters %v after expiry", got)
+	}
+
+	now = now.Add(time.Minute)
+	c.flush()
+	bus.ExpectNoEvent(t, 10*time.Millisecond)
+}
+
+func TestClientNoInterval(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	c := NewClient("lwes-test", 0, bus.Emitter())
+	c.Increment("requests", 1)
+	bus.ExpectNoEvent(t, 10*time.Millisecond)
+
+	c.Close()
+	st, err := DecodeStatsMsg(bus.ExpectEvent(t, StatsMsgName, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Metrics) != 1 || st.Metrics[0] != (Metric{Counter, "requests", 1}) {
+		t.Fatalf("unexpected metrics %v", st.Metrics)
+	}
+}
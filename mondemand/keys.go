@@ -0,0 +1,33 @@
+package mondemand
+
+import "strconv"
+
+const (
+	precachedSize = 1024
+)
+
+var (
+	cached map[string][]string
+)
+
+func init() {
+	cached = make(map[string][]string)
+	for _, key := range []string{"k", "v", "t", "ctxt_k", "ctxt_v", "label", "start", "end", "f", "l", "p", "m", "r"} {
+		cached[key] = make([]string, precachedSize)
+		for i := 0; i < precachedSize; i++ {
+			cached[key][i] = key + strconv.Itoa(i)
+		}
+	}
+}
+
+// getK returns the indexed key like "k0", "ctxt_v12"; the common ones
+// are precached to save the allocations of every event
+func getK(key string, idx int) string {
+	if idx >= precachedSize {
+		return key + strconv.Itoa(idx)
+	}
+	if strs, ok := cached[key]; ok {
+		return strs[idx]
+	}
+	return key + strconv.Itoa(idx)
+}
@@ -0,0 +1,131 @@
+package mondemand
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/lwes/lwes-go"
+)
+
+const LogMsgName = "MonDemand::LogMsg"
+
+// the levels of the log entries, as in syslog
+const (
+	LevelEmerg   = "emerg"
+	LevelAlert   = "alert"
+	LevelCrit    = "crit"
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelNotice  = "notice"
+	LevelInfo    = "info"
+	LevelDebug   = "debug"
+)
+
+// LogEntry is a log line, encoded with the indexed keys
+// f (file), l (line), p (level), m (message), r (repeat) and
+// t (trace id, omitted if empty)
+type LogEntry struct {
+	File    string
+	Line    uint32
+	Level   string
+	Message string
+	Repeat  uint16 // how many times the same line is logged
+	TraceID string
+}
+
+// LogMsg is the MonDemand::LogMsg event: the log lines of a program
+type LogMsg struct {
+	ProgID  string
+	Context []KeyValue
+	Entries []LogEntry
+
+	// the receipt attributes of the event, if it carries them
+	ReceiptTime int64
+	SenderIP    net.IP
+	SenderPort  uint16
+}
+
+func NewLogMsg(progID string) *LogMsg {
+	return &LogMsg{ProgID: progID}
+}
+
+func (msg *LogMsg) AddContext(key, value string) {
+	msg.Context = append(msg.Context, KeyValue{key, value})
+}
+
+func (msg *LogMsg) AddEntry(entry LogEntry) {
+	msg.Entries = append(msg.Entries, entry)
+}
+
+// ToLwes encodes the msg as an lwes event
+func (msg *LogMsg) ToLwes() *lwes.LwesEvent {
+	lwe := lwes.NewLwesEvent(LogMsgName)
+	lwe.Set("prog_id", msg.ProgID)
+
+	setContext(lwe, msg.Context)
+
+	lwe.Set("num", uint16(len(msg.Entries)))
+	for idx, e := range msg.Entries {
+		lwe.Set(getK("f", idx), e.File)
+		lwe.Set(getK("l", idx), e.Line)
+		lwe.Set(getK("p", idx), e.Level)
+		lwe.Set(getK("m", idx), e.Message)
+		lwe.Set(getK("r", idx), e.Repeat)
+		if e.TraceID != "" {
+			lwe.Set(getK("t", idx), e.TraceID)
+		}
+	}
+
+	return lwe
+}
+
+// DecodeLogMsg decodes a MonDemand::LogMsg lwes event
+func DecodeLogMsg(lwe *lwes.LwesEvent) (*LogMsg, error) {
+	if lwe.Name != LogMsgName {
+		return nil, fmt.Errorf("not a %s but %q", LogMsgName, lwe.Name)
+	}
+
+	msg := &LogMsg{}
+	var err error
+	if msg.ProgID, err = getString(lwe, "prog_id"); err != nil {
+		return nil, err
+	}
+	if msg.Context, err = getContext(lwe); err != nil {
+		return nil, err
+	}
+
+	num, err := getNum(lwe, "num")
+	if err != nil {
+		return nil, err
+	}
+	msg.Entries = make([]LogEntry, 0, num)
+	for i := 0; i < num; i++ {
+		var e LogEntry
+		if e.File, err = getString(lwe, getK("f", i)); err != nil {
+			return nil, err
+		}
+		line, err := getInt64(lwe, getK("l", i))
+		if err != nil {
+			return nil, err
+		}
+		e.Line = uint32(line)
+		if e.Level, err = getString(lwe, getK("p", i)); err != nil {
+			return nil, err
+		}
+		if e.Message, err = getString(lwe, getK("m", i)); err != nil {
+			return nil, err
+		}
+		if repeat, ok := lwe.Attrs[getK("r", i)].(uint16); ok {
+			e.Repeat = repeat
+		}
+		if _, ok := lwe.Attrs[getK("t", i)]; ok {
+			if e.TraceID, err = getString(lwe, getK("t", i)); err != nil {
+				return nil, err
+			}
+		}
+		msg.Entries = append(msg.Entries, e)
+	}
+
+	msg.ReceiptTime, msg.SenderIP, msg.SenderPort = getSender(lwe)
+	return msg, nil
+}
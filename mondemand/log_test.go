@@ -0,0 +1,87 @@
+package mondemand
+
+import (
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lwes/lwes-go"
+	"github.com/lwes/lwes-go/lwestest"
+)
+
+func roundTrip(t *testing.T, lwe *lwes.LwesEvent) *lwes.LwesEvent {
+	t.Helper()
+	buf, err := lwes.Marshal(lwe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(lwes.LwesEvent)
+	if err := lwes.Unmarshal(buf, decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestLogMsgRoundTrip(t *testing.T) {
+	msg := NewLogMsg("lwes-test")
+	msg.AddContext("host", "localhost")
+	msg.AddEntry(LogEntry{File: "main.go", Line: 42, Level: LevelError, Message: "failed", Repeat: 1, TraceID: "abc"})
+	msg.AddEntry(LogEntry{File: "main.go", Line: 43, Level: LevelInfo, Message: "done", Repeat: 2})
+
+	got, err := DecodeLogMsg(roundTrip(t, msg.ToLwes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Fatalf("got %+v, want %+v", got, msg)
+	}
+}
+
+func TestTraceMsgRoundTrip(t *testing.T) {
+	msg := NewTraceMsg("lwes-test", "alice", "abc", "hello")
+	msg.AddContext("request", "GET /")
+	lwe, err := msg.ToLwes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodeTraceMsg(roundTrip(t, lwe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Fatalf("got %+v, want %+v", got, msg)
+	}
+
+	msg.AddContext("mondemand.owner", "bob")
+	if _, err := msg.ToLwes(); err == nil {
+		t.Fatal("expected an error on a reserved context key")
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	h := NewLogHandler("lwes-test", bus.Emitter(), &slog.HandlerOptions{Level: slog.LevelInfo})
+	logger := slog.New(h).With("host", "localhost").WithGroup("req")
+
+	logger.Debug("not emitted")
+	logger.Warn("slow request", "path", "/index", slog.String(TraceIDKey, "abc"))
+
+	msg, err := DecodeLogMsg(bus.ExpectEvent(t, LogMsgName, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Context) != 1 || msg.Context[0] != (KeyValue{"host", "localhost"}) {
+		t.Fatalf("unexpected context %v", msg.Context)
+	}
+	e := msg.Entries[0]
+	if e.Level != LevelWarning || e.Message != "slow request req.path=/index" || e.TraceID != "abc" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if !strings.HasSuffix(e.File, "log_test.go") || e.Line == 0 {
+		t.Fatalf("unexpected source %s:%d", e.File, e.Line)
+	}
+}
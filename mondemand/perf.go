@@ -0,0 +1,157 @@
+package mondemand
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lwes/lwes-go"
+)
+
+const PerfMsgName = "MonDemand::PerfMsg"
+
+// Timeline is a labeled span of a trace, in milliseconds since the epoch
+type Timeline struct {
+	Label      string
+	Start, End int64
+}
+
+// StartTime and EndTime convert the milliseconds to time.Time
+func (tl Timeline) StartTime() time.Time { return time.UnixMilli(tl.Start) }
+func (tl Timeline) EndTime() time.Time   { return time.UnixMilli(tl.End) }
+
+// PerfMsg is the MonDemand::PerfMsg event: the timelines of a request
+// identified by ID, as seen by the CallerLabel
+type PerfMsg struct {
+	ID          string
+	CallerLabel string
+	Context     []KeyValue
+	Timelines   []Timeline
+
+	// the receipt attributes of the event, if it carries them
+	ReceiptTime int64
+	SenderIP    net.IP
+	SenderPort  uint16
+
+	mutex sync.Mutex // guards the Timelines added by the spans
+}
+
+func NewPerfMsg(id, callerLabel string) *PerfMsg {
+	return &PerfMsg{ID: id, CallerLabel: callerLabel}
+}
+
+func (msg *PerfMsg) AddContext(key, value string) {
+	msg.Context = append(msg.Context, KeyValue{key, value})
+}
+
+func (msg *PerfMsg) AddTimeline(label string, start, end int64) {
+	msg.mutex.Lock()
+	msg.Timelines = append(msg.Timelines, Timeline{label, start, end})
+	msg.mutex.Unlock()
+}
+
+// Span times a code path for a Timeline of the PerfMsg
+type Span struct {
+	msg   *PerfMsg
+	label string
+	start time.Time
+	once  sync.Once
+}
+
+// Start a span labeled label now; its Stop adds the Timeline to the msg.
+// The spans may be started and stopped concurrently.
+func (msg *PerfMsg) Start(label string) *Span {
+	return &Span{msg: msg, label: label, start: time.Now()}
+}
+
+// Stop the span and add its Timeline; only the first Stop counts
+func (s *Span) Stop() {
+	s.once.Do(func() {
+		s.msg.AddTimeline(s.label, s.start.UnixMilli(), time.Now().UnixMilli())
+	})
+}
+
+// Encode the msg as an lwes event
+func (msg *PerfMsg) Encode() (*lwes.LwesEvent, error) {
+	msg.mutex.Lock()
+	defer msg.mutex.Unlock()
+
+	if msg.ID == "" {
+		return nil, fmt.Errorf("%s: missing id", PerfMsgName)
+	}
+	if len(msg.Timelines) > 0xffff || len(msg.Context) > 0xffff {
+		return nil, fmt.Errorf("%s: too many timelines %d or context %d", PerfMsgName, len(msg.Timelines), len(msg.Context))
+	}
+
+	lwe := lwes.NewLwesEvent(PerfMsgName)
+	lwe.Set("id", msg.ID)
+	lwe.Set("caller_label", msg.CallerLabel)
+
+	lwe.Set("num", uint16(len(msg.Timelines)))
+	for idx, tl := range msg.Timelines {
+		lwe.Set(getK("label", idx), tl.Label)
+		lwe.Set(getK("start", idx), tl.Start)
+		lwe.Set(getK("end", idx), tl.End)
+	}
+
+	if len(msg.Context) != 0 {
+		setContext(lwe, msg.Context)
+	} // omit ctxt if no context at all
+
+	return lwe, nil
+}
+
+// Decode a MonDemand::PerfMsg lwes event into the msg
+func (msg *PerfMsg) Decode(lwe *lwes.LwesEvent) error {
+	if lwe.Name != PerfMsgName {
+		return fmt.Errorf("not a %s but %q", PerfMsgName, lwe.Name)
+	}
+
+	var err error
+	if msg.ID, err = getString(lwe, "id"); err != nil {
+		return err
+	}
+	if msg.CallerLabel, err = getString(lwe, "caller_label"); err != nil {
+		return err
+	}
+	// some lwes events come with no context, it's ok
+	if msg.Context, err = getContext(lwe); err != nil {
+		return err
+	}
+
+	num, err := getNum(lwe, "num")
+	if err != nil {
+		return err
+	}
+	timelines := make([]Timeline, 0, num)
+	for i := 0; i < num; i++ {
+		var tl Timeline
+		if tl.Label, err = getString(lwe, getK("label", i)); err != nil {
+			return err
+		}
+		if tl.Start, err = getInt64(lwe, getK("start", i)); err != nil {
+			return err
+		}
+		if tl.End, err = getInt64(lwe, getK("end", i)); err != nil {
+			return err
+		}
+		timelines = append(timelines, tl)
+	}
+
+	msg.mutex.Lock()
+	msg.Timelines = timelines
+	msg.mutex.Unlock()
+
+	msg.ReceiptTime, msg.SenderIP, msg.SenderPort = getSender(lwe)
+	return nil
+}
+
+// DecodePerfMsg decodes a MonDemand::PerfMsg lwes event
+func DecodePerfMsg(lwe *lwes.LwesEvent) (*PerfMsg, error) {
+	msg := new(PerfMsg)
+	if err := msg.Decode(lwe); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,93 @@
+package mondemand
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/lwes/lwes-go"
+)
+
+func TestPerfMsgRoundTrip(t *testing.T) {
+	msg := NewPerfMsg("0db302ef-4ba1-4d6b-86e3-92793d4b0c9e", "broker")
+	msg.AddContext("platform_hash", "7e319737-a81c-4817-bdc6-8f596e5caa46")
+	msg.AddTimeline("adunit:538494050:call:1:ssrtb", 1494880081332, 1494880081487)
+
+	lwe, err := msg.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := lwes.Marshal(lwe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(lwes.LwesEvent)
+	if err := lwes.Unmarshal(buf, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodePerfMsg(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != msg.ID || got.CallerLabel != msg.CallerLabel ||
+		!reflect.DeepEqual(got.Context, msg.Context) || !reflect.DeepEqual(got.Timelines, msg.Timelines) {
+		t.Fatalf("got %+v, want %+v", got, msg)
+	}
+}
+
+func TestPerfMsgDecodeErrors(t *testing.T) {
+	lwe := lwes.NewLwesEvent(PerfMsgName)
+	lwe.Set("id", "1")
+	lwe.Set("caller_label", "broker")
+	lwe.Set("num", uint16(1))
+	lwe.Set("label0", "call")
+	lwe.Set("start0", int64(1))
+	if _, err := DecodePerfMsg(lwe); err == nil {
+		t.Fatal("expected an error on the missing end0")
+	}
+
+	lwe.Set("end0", int64(2))
+	lwe.Set("ctxt_num", int32(1))
+	if _, err := DecodePerfMsg(lwe); err == nil {
+		t.Fatal("expected an error on ctxt_num not an uint16")
+	}
+
+	delete(lwe.Attrs, "num")
+	if _, err := DecodePerfMsg(lwe); err == nil {
+		t.Fatal("expected an error on the missing num")
+	}
+}
+
+func TestPerfMsgSpans(t *testing.T) {
+	msg := NewPerfMsg("1", "broker")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			span := msg.Start("call")
+			span.Stop()
+			span.Stop()
+		}()
+	}
+	wg.Wait()
+
+	lwe, err := msg.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lwe.Attrs["num"] != uint16(10) {
+		t.Fatalf("expected 10 timelines, got %v", lwe.Attrs["num"])
+	}
+	for _, tl := range msg.Timelines {
+		if tl.Label != "call" || tl.End < tl.Start {
+			t.Fatalf("unexpected timeline %+v", tl)
+		}
+	}
+
+	if _, err := NewPerfMsg("", "broker").Encode(); err == nil {
+		t.Fatal("expected an error on the missing id")
+	}
+}
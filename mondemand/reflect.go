@@ -0,0 +1,51 @@
+package mondemand
+
+import "github.com/lwes/lwes-go/internal/stattag"
+
+// StatTag is the struct tag of the fields reported as stats, like
+// `mondemand_stat:"queue_size,gauge"`; the type is counter by default
+const StatTag = stattag.Tag
+
+// ReportContextKey is the context key of the name of the metrics
+// reported by MetricsReporter
+const ReportContextKey = "report"
+
+// StructMetrics returns the metrics of the tagged fields of the struct v,
+// or of the struct v points to, in the order of the fields; the floats
+// are truncated. It returns nil for anything else.
+func StructMetrics(v interface{}) []Metric {
+	var ms []Metric
+	stattag.Enumerate(v, func(key, typ string, value int64) {
+		ms = append(ms, Metric{typ, key, value})
+	})
+	return ms
+}
+
+func (c *Client) setStruct(ctxt *metricContext, v interface{}) {
+	for _, m := range StructMetrics(v) {
+		op := opSetCounter
+		if m.Type == Gauge {
+			op = opSetGauge
+		}
+		c.send(update{op, m.Key, m.Value, ctxt})
+	}
+}
+
+// SetStruct sets the counters and the gauges of the tagged fields of
+// the struct v, which are the totals so far, like the metrics of a server
+func (c *Client) SetStruct(v interface{}) {
+	c.setStruct(nil, v)
+}
+
+func (s *Scope) SetStruct(v interface{}) {
+	s.client.setStruct(s.ctxt, v)
+}
+
+// MetricsReporter returns a reportFunc for the EnableMetricsReport of an
+// lwes.Server, setting the metrics reported under each name in the
+// context of ReportContextKey and the name
+func MetricsReporter(c *Client) func(string, interface{}) {
+	return func(name string, v interface{}) {
+		c.WithContext(KeyValue{ReportContextKey, name}).SetStruct(v)
+	}
+}
@@ -0,0 +1,77 @@
+package mondemand
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go/lwestest"
+)
+
+type baseStats struct {
+	Errors int32 `mondemand_stat:"errors"`
+}
+
+type testStats struct {
+	baseStats
+	QueueSize uint16  `mondemand_stat:"queue_size,gauge"`
+	Latency   float64 `mondemand_stat:"latency,gauge"`
+	Requests  int64   `mondemand_stat:"requests"`
+	Ignored   int64   `mondemand_stat:"-"`
+	Untagged  int64
+	Name      string `mondemand_stat:"name"`
+	Conns     struct {
+		Active int `mondemand_stat:"active,gauge"`
+	} `mondemand_stat:"conns"`
+}
+
+func TestStructMetrics(t *testing.T) {
+	v := testStats{baseStats{1}, 2, 3.7, 4, 5, 6, "x", struct {
+		Active int `mondemand_stat:"active,gauge"`
+	}{7}}
+	want := []Metric{
+		{Counter, "errors", 1},
+		{Gauge, "queue_size", 2},
+		{Gauge, "latency", 3},
+		{Counter, "requests", 4},
+		{Gauge, "conns_active", 7},
+	}
+	for _, got := range [][]Metric{StructMetrics(v), StructMetrics(&v)} {
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if ms := StructMetrics(42); ms != nil {
+		t.Fatalf("got %v for an int", ms)
+	}
+	if ms := StructMetrics((*testStats)(nil)); ms != nil {
+		t.Fatalf("got %v for a nil pointer", ms)
+	}
+}
+
+func TestMetricsReporter(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	c := NewClient("lwes-test", time.Hour, bus.Emitter())
+	defer c.Close()
+
+	report := MetricsReporter(c)
+	report("lwes-events", struct {
+		Received int64 `mondemand_stat:"packets_received"`
+		Queue    int64 `mondemand_stat:"queue_size,gauge"`
+	}{10, 2})
+	c.Flush()
+
+	st, err := DecodeStatsMsg(bus.ExpectEvent(t, StatsMsgName, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Metric{{Counter, "packets_received", 10}, {Gauge, "queue_size", 2}}
+	if !reflect.DeepEqual(st.Metrics, want) {
+		t.Fatalf("got metrics %v, want %v", st.Metrics, want)
+	}
+	if len(st.Context) != 1 || st.Context[0] != (KeyValue{ReportContextKey, "lwes-events"}) {
+		t.Fatalf("unexpected context %v", st.Context)
+	}
+}
@@ -0,0 +1,151 @@
+package mondemand
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/lwes/lwes-go"
+)
+
+// TraceIDKey is the key of the slog attribute taken as the trace id
+// of the log entry
+const TraceIDKey = "trace_id"
+
+// LogHandler is a slog.Handler emitting each record as a LogMsg:
+// the attributes added by WithAttrs become the context of the LogMsg,
+// and the attributes of the record are appended to its message as
+// key=value pairs
+type LogHandler struct {
+	emitter *lwes.Emitter
+	progID  string
+	level   slog.Leveler
+
+	context []KeyValue
+	prefix  string // the groups joined by "."
+	traceID string
+}
+
+// NewLogHandler returns a handler emitting the LogMsgs of progID through
+// the emitter; only the Level of the opts is used
+func NewLogHandler(progID string, em *lwes.Emitter, opts *slog.HandlerOptions) *LogHandler {
+	h := &LogHandler{emitter: em, progID: progID, level: slog.LevelInfo}
+	if opts != nil && opts.Level != nil {
+		h.level = opts.Level
+	}
+	return h
+}
+
+func (h *LogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func levelName(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return LevelError
+	case level >= slog.LevelWarn:
+		return LevelWarning
+	case level >= slog.LevelInfo:
+		return LevelInfo
+	default:
+		return LevelDebug
+	}
+}
+
+func (h *LogHandler) Handle(_ context.Context, r slog.Record) error {
+	entry := LogEntry{Level: levelName(r.Level), Repeat: 1, TraceID: h.traceID}
+
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		entry.File, entry.Line = frame.File, uint32(frame.Line)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		h.appendAttr(&sb, &entry, h.prefix, a)
+		return true
+	})
+	entry.Message = sb.String()
+
+	msg := NewLogMsg(h.progID)
+	msg.Context = h.context
+	msg.AddEntry(entry)
+	return h.emitter.Emit(msg.ToLwes())
+}
+
+func (h *LogHandler) appendAttr(sb *strings.Builder, entry *LogEntry, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			h.appendAttr(sb, entry, prefix, ga)
+		}
+		return
+	}
+	if a.Key == TraceIDKey {
+		entry.TraceID = a.Value.String()
+		return
+	}
+
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"") {
+		value = strconv.Quote(value)
+	}
+	sb.WriteString(" ")
+	sb.WriteString(prefix + a.Key)
+	sb.WriteString("=")
+	sb.WriteString(value)
+}
+
+func (h *LogHandler) clone() *LogHandler {
+	c := *h
+	c.context = append([]KeyValue(nil), h.context...)
+	return &c
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := h.clone()
+	for _, a := range attrs {
+		c.addContext(c.prefix, a)
+	}
+	return c
+}
+
+func (h *LogHandler) addContext(prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			h.addContext(prefix, ga)
+		}
+		return
+	}
+	if a.Key == TraceIDKey {
+		h.traceID = a.Value.String()
+		return
+	}
+	h.context = append(h.context, KeyValue{prefix + a.Key, a.Value.String()})
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := h.clone()
+	c.prefix += name + "."
+	return c
+}
@@ -0,0 +1,204 @@
+// Package mondemand implements the MonDemand events over lwes:
+// the StatsMsg with a client aggregating the stats to emit periodically,
+// the PerfMsg of the timelines traced through the code paths, and the
+// LogMsg and TraceMsg with a slog.Handler emitting the LogMsgs.
+//
+//	https://github.com/mondemand/mondemand (MonDemand C library)
+//	https://github.com/mondemand/mondemand-erlang (MonDemand Erlang library)
+package mondemand
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/lwes/lwes-go"
+)
+
+const StatsMsgName = "MonDemand::StatsMsg"
+
+// the types of the stats
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// KeyValue is a pair of the context, which keeps its order in the event
+type KeyValue struct {
+	Key, Value string
+}
+
+type Metric struct {
+	Type  string // Counter, Gauge, or a statset type like StatsetMax
+	Key   string
+	Value int64
+}
+
+// StatsMsg is the MonDemand::StatsMsg event: the stats of a program,
+// and the context they are measured in, like the host
+type StatsMsg struct {
+	ProgID  string
+	Context []KeyValue
+	Metrics []Metric
+
+	// the receipt attributes of the event, if it carries them
+	ReceiptTime int64
+	SenderIP    net.IP
+	SenderPort  uint16
+}
+
+func NewStatsMsg(progID string) *StatsMsg {
+	return &StatsMsg{
+		ProgID:  progID,
+		Metrics: make([]Metric, 0, 10),
+	}
+}
+
+func (st *StatsMsg) AddContext(key, value string) {
+	st.Context = append(st.Context, KeyValue{key, value})
+}
+
+func (st *StatsMsg) AddMetric(typ, key string, value int64) {
+	st.Metrics = append(st.Metrics, Metric{Type: typ, Key: key, Value: value})
+}
+
+// ToLwes encodes the msg as an lwes event
+func (st *StatsMsg) ToLwes() *lwes.LwesEvent {
+	lwe := lwes.NewLwesEvent(StatsMsgName)
+	lwe.Set("prog_id", st.ProgID)
+
+	setContext(lwe, st.Context)
+
+	lwe.Set("num", uint16(len(st.Metrics)))
+	for idx, metric := range st.Metrics {
+		lwe.Set(getK("t", idx), metric.Type)
+		lwe.Set(getK("k", idx), metric.Key)
+		lwe.Set(getK("v", idx), metric.Value)
+	}
+
+	return lwe
+}
+
+func setContext(lwe *lwes.LwesEvent, context []KeyValue) {
+	lwe.Set("ctxt_num", uint16(len(context)))
+	for idx, kv := range context {
+		lwe.Set(getK("ctxt_k", idx), kv.Key)
+		lwe.Set(getK("ctxt_v", idx), kv.Value)
+	}
+}
+
+// DecodeStatsMsg decodes a MonDemand::StatsMsg lwes event; a metric
+// without its type is taken as a Gauge
+func DecodeStatsMsg(lwe *lwes.LwesEvent) (*StatsMsg, error) {
+	if lwe.Name != StatsMsgName {
+		return nil, fmt.Errorf("not a %s but %q", StatsMsgName, lwe.Name)
+	}
+
+	st := &StatsMsg{}
+	var err error
+	if st.ProgID, err = getString(lwe, "prog_id"); err != nil {
+		return nil, err
+	}
+	if st.Context, err = getContext(lwe); err != nil {
+		return nil, err
+	}
+
+	num, err := getNum(lwe, "num")
+	if err != nil {
+		return nil, err
+	}
+	st.Metrics = make([]Metric, 0, num)
+	for i := 0; i < num; i++ {
+		m := Metric{Type: Gauge}
+		if _, ok := lwe.Attrs[getK("t", i)]; ok {
+			if m.Type, err = getString(lwe, getK("t", i)); err != nil {
+				return nil, err
+			}
+		}
+		if m.Key, err = getString(lwe, getK("k", i)); err != nil {
+			return nil, err
+		}
+		if m.Value, err = getInt64(lwe, getK("v", i)); err != nil {
+			return nil, err
+		}
+		st.Metrics = append(st.Metrics, m)
+	}
+
+	st.ReceiptTime, st.SenderIP, st.SenderPort = getSender(lwe)
+	return st, nil
+}
+
+func getString(lwe *lwes.LwesEvent, key string) (string, error) {
+	v, ok := lwe.Attrs[key]
+	if !ok {
+		return "", fmt.Errorf("%s: missing %s", lwe.Name, key)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: %s is %T, not a string", lwe.Name, key, v)
+	}
+	return s, nil
+}
+
+func getInt64(lwe *lwes.LwesEvent, key string) (int64, error) {
+	switch v := lwe.Attrs[key].(type) {
+	case nil:
+		return 0, fmt.Errorf("%s: missing %s", lwe.Name, key)
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("%s: %s is %T, not an integer", lwe.Name, key, v)
+	}
+}
+
+// getNum gets a count of the indexed keys, which is an uint16
+func getNum(lwe *lwes.LwesEvent, key string) (int, error) {
+	v, ok := lwe.Attrs[key]
+	if !ok {
+		return 0, fmt.Errorf("%s: missing %s", lwe.Name, key)
+	}
+	n, ok := v.(uint16)
+	if !ok {
+		return 0, fmt.Errorf("%s: %s is %T, not an uint16", lwe.Name, key, v)
+	}
+	return int(n), nil
+}
+
+// getContext gets the context, which is optional
+func getContext(lwe *lwes.LwesEvent) ([]KeyValue, error) {
+	if _, ok := lwe.Attrs["ctxt_num"]; !ok {
+		return nil, nil
+	}
+	num, err := getNum(lwe, "ctxt_num")
+	if err != nil {
+		return nil, err
+	}
+
+	context := make([]KeyValue, 0, num)
+	for i := 0; i < num; i++ {
+		var kv KeyValue
+		if kv.Key, err = getString(lwe, getK("ctxt_k", i)); err != nil {
+			return nil, err
+		}
+		if kv.Value, err = getString(lwe, getK("ctxt_v", i)); err != nil {
+			return nil, err
+		}
+		context = append(context, kv)
+	}
+	return context, nil
+}
+
+// getSender gets the receipt attributes of the event, if any
+func getSender(lwe *lwes.LwesEvent) (receiptTime int64, senderIP net.IP, senderPort uint16) {
+	receiptTime, _ = lwe.Attrs[lwes.ReceiptTimeKey].(int64)
+	senderIP, _ = lwe.Attrs[lwes.SenderIPKey].(net.IP)
+	senderPort, _ = lwe.Attrs[lwes.SenderPortKey].(uint16)
+	return
+}
@@ -0,0 +1,52 @@
+package mondemand
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lwes/lwes-go"
+)
+
+func TestStatsMsgRoundTrip(t *testing.T) {
+	st := NewStatsMsg("lwes-test")
+	st.AddContext("host", "localhost")
+	st.AddContext("cluster", "east")
+	st.AddMetric(Counter, "requests", 100)
+	st.AddMetric(Gauge, "connections", 7)
+
+	buf, err := lwes.Marshal(st.ToLwes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lwe := new(lwes.LwesEvent)
+	if err := lwes.Unmarshal(buf, lwe); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodeStatsMsg(lwe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, st) {
+		t.Fatalf("got %+v, want %+v", got, st)
+	}
+}
+
+func TestDecodeStatsMsgErrors(t *testing.T) {
+	lwe := lwes.NewLwesEvent(StatsMsgName)
+	lwe.Set("prog_id", "lwes-test")
+	lwe.Set("num", uint16(1))
+	lwe.Set("k0", "requests")
+	if _, err := DecodeStatsMsg(lwe); err == nil {
+		t.Fatal("expected an error on the missing v0")
+	}
+
+	lwe.Set("v0", "100")
+	if _, err := DecodeStatsMsg(lwe); err == nil {
+		t.Fatal("expected an error on v0 not an integer")
+	}
+
+	if _, err := DecodeStatsMsg(lwes.NewLwesEvent("MonDemand::PerfMsg")); err == nil {
+		t.Fatal("expected an error on another event")
+	}
+}
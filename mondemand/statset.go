@@ -0,0 +1,90 @@
+package mondemand
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the types of the sampled stats of a statset, emitted every interval
+const (
+	StatsetCount  = "count"
+	StatsetSum    = "sum"
+	StatsetMin    = "min"
+	StatsetMax    = "max"
+	StatsetAvg    = "avg"
+	StatsetMedian = "median"
+)
+
+var (
+	defaultPercentiles   = []float64{75, 90, 95, 98, 99}
+	defaultReservoirSize = 1024
+)
+
+// percentileType returns the type of a percentile, like "pctl_95" or
+// "pctl_99_9"
+func percentileType(p float64) string {
+	return "pctl_" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+}
+
+// statset samples the values observed in an interval: the count, sum,
+// min and max are exact, the median and the percentiles are computed
+// from a uniform sample of the values kept in a fixed size reservoir
+type statset struct {
+	count    int64
+	sum      int64
+	min, max int64
+	samples  []int64
+}
+
+func (s *statset) observe(value int64, size int, rnd *rand.Rand) {
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+	s.count++
+	s.sum += value
+
+	// the reservoir sampling: the n-th value replaces a random sample
+	// with the probability of size/n
+	if len(s.samples) < size {
+		s.samples = append(s.samples, value)
+	} else if i := rnd.Int63n(s.count); i < int64(size) {
+		s.samples[i] = value
+	}
+}
+
+// quantile of the sorted samples by the nearest rank
+func quantile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// metrics of the statset of the key, in the order of the MonDemand
+// statsets
+func (s *statset) metrics(key string, percentiles []float64) []Metric {
+	sort.Slice(s.samples, func(i, j int) bool { return s.samples[i] < s.samples[j] })
+
+	ms := []Metric{
+		{StatsetCount, key, s.count},
+		{StatsetSum, key, s.sum},
+		{StatsetMin, key, s.min},
+		{StatsetMax, key, s.max},
+		{StatsetAvg, key, s.sum / s.count},
+		{StatsetMedian, key, quantile(s.samples, 50)},
+	}
+	for _, p := range percentiles {
+		ms = append(ms, Metric{percentileType(p), key, quantile(s.samples, p)})
+	}
+	return ms
+}
@@ -0,0 +1,76 @@
+package mondemand
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go/lwestest"
+)
+
+func TestClientObserve(t *testing.T) {
+	bus := lwestest.NewBus(lwestest.Config{})
+	defer bus.Close()
+
+	c := NewClientWithConfig(ClientConfig{
+		ProgID:      "lwes-test",
+		Interval:    time.Hour,
+		Percentiles: []float64{90, 99.9},
+	}, bus.Emitter())
+	defer c.Close()
+
+	for i := int64(1); i <= 100; i++ {
+		c.Observe("latency", i)
+	}
+	c.Flush()
+
+	st, err := DecodeStatsMsg(bus.ExpectEvent(t, StatsMsgName, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Metric{
+		{StatsetCount, "latency", 100},
+		{StatsetSum, "latency", 5050},
+		{StatsetMin, "latency", 1},
+		{StatsetMax, "latency", 100},
+		{StatsetAvg, "latency", 50},
+		{StatsetMedian, "latency", 50},
+		{"pctl_90", "latency", 90},
+		{"pctl_99_9", "latency", 100},
+	}
+	if len(st.Metrics) != len(want) {
+		t.Fatalf("got metrics %v, want %v", st.Metrics, want)
+	}
+	for i := range want {
+		if st.Metrics[i] != want[i] {
+			t.Fatalf("got metric %v, want %v", st.Metrics[i], want[i])
+		}
+	}
+
+	// the statsets start over every interval
+	c.Flush()
+	bus.ExpectNoEvent(t, 10*time.Millisecond)
+}
+
+func TestStatsetReservoir(t *testing.T) {
+	var s statset
+	rnd := rand.New(rand.NewSource(1))
+	for i := int64(1); i <= 100000; i++ {
+		s.observe(i, 1000, rnd)
+	}
+	if len(s.samples) != 1000 {
+		t.Fatalf("expected the samples bounded to 1000, got %d", len(s.samples))
+	}
+
+	ms := s.metrics("k", []float64{90})
+	if ms[0].Value != 100000 || ms[2].Value != 1 || ms[3].Value != 100000 {
+		t.Fatalf("expected the exact count, min and max, got %v", ms)
+	}
+	// the sampled median and percentile are close to the exact ones
+	if median := ms[5].Value; median < 45000 || median > 55000 {
+		t.Fatalf("sampled median %d too far from 50000", median)
+	}
+	if p90 := ms[6].Value; p90 < 87000 || p90 > 93000 {
+		t.Fatalf("sampled pctl_90 %d too far from 90000", p90)
+	}
+}
@@ -0,0 +1,100 @@
+package mondemand
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/lwes/lwes-go"
+)
+
+const TraceMsgName = "MonDemand::TraceMsg"
+
+// the keys of the TraceMsg; the other attributes are its context
+const (
+	traceProgIDKey  = "mondemand.prog_id"
+	traceOwnerKey   = "mondemand.owner"
+	traceIDKey      = "mondemand.trace_id"
+	traceMessageKey = "mondemand.message"
+)
+
+// TraceMsg is the MonDemand::TraceMsg event: a message of a program
+// traced by its owner under a trace id, with the context as the other
+// string attributes of the event
+type TraceMsg struct {
+	ProgID  string
+	Owner   string
+	TraceID string
+	Message string
+	Context []KeyValue
+
+	// the receipt attributes of the event, if it carries them
+	ReceiptTime int64
+	SenderIP    net.IP
+	SenderPort  uint16
+}
+
+func NewTraceMsg(progID, owner, traceID, message string) *TraceMsg {
+	return &TraceMsg{ProgID: progID, Owner: owner, TraceID: traceID, Message: message}
+}
+
+func (msg *TraceMsg) AddContext(key, value string) {
+	msg.Context = append(msg.Context, KeyValue{key, value})
+}
+
+// ToLwes encodes the msg as an lwes event; it fails on a context key
+// which clashes with the keys of the TraceMsg
+func (msg *TraceMsg) ToLwes() (*lwes.LwesEvent, error) {
+	lwe := lwes.NewLwesEvent(TraceMsgName)
+	lwe.Set(traceProgIDKey, msg.ProgID)
+	lwe.Set(traceOwnerKey, msg.Owner)
+	lwe.Set(traceIDKey, msg.TraceID)
+	lwe.Set(traceMessageKey, msg.Message)
+
+	for _, kv := range msg.Context {
+		if _, ok := lwe.Attrs[kv.Key]; ok || strings.HasPrefix(kv.Key, "mondemand.") {
+			return nil, fmt.Errorf("%s: the context key %q is reserved", TraceMsgName, kv.Key)
+		}
+		lwe.Set(kv.Key, kv.Value)
+	}
+
+	return lwe, nil
+}
+
+// DecodeTraceMsg decodes a MonDemand::TraceMsg lwes event; the string
+// attributes other than its keys are the context, in the order of the
+// event
+func DecodeTraceMsg(lwe *lwes.LwesEvent) (*TraceMsg, error) {
+	if lwe.Name != TraceMsgName {
+		return nil, fmt.Errorf("not a %s but %q", TraceMsgName, lwe.Name)
+	}
+
+	msg := &TraceMsg{}
+	var err error
+	if msg.ProgID, err = getString(lwe, traceProgIDKey); err != nil {
+		return nil, err
+	}
+	if msg.Owner, err = getString(lwe, traceOwnerKey); err != nil {
+		return nil, err
+	}
+	if msg.TraceID, err = getString(lwe, traceIDKey); err != nil {
+		return nil, err
+	}
+	if msg.Message, err = getString(lwe, traceMessageKey); err != nil {
+		return nil, err
+	}
+
+	lwe.Enumerate(func(key string, value interface{}) bool {
+		switch key {
+		case traceProgIDKey, traceOwnerKey, traceIDKey, traceMessageKey:
+		default:
+			if s, ok := value.(string); ok {
+				msg.Context = append(msg.Context, KeyValue{key, s})
+			}
+		}
+		return true
+	})
+
+	msg.ReceiptTime, msg.SenderIP, msg.SenderPort = getSender(lwe)
+	return msg, nil
+}
@@ -0,0 +1,238 @@
+package lwes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// OversizePolicy decides what the Emitter does with an event whose
+// encoded size exceeds the limit of its transports
+type OversizePolicy int
+
+const (
+	// OversizeReject fails the Emit with an *EventTooLargeError
+	OversizeReject OversizePolicy = iota
+	// OversizeTruncate cuts the longest string attributes to fit
+	OversizeTruncate
+	// OversizeSplit spreads the indexed attributes counted by the split
+	// key of the Emitter, "num" by default like the MonDemand k0..kN
+	// metrics, over multiple events; see Split for the layout. An event
+	// not in the layout fails with an *EventTooLargeError
+	OversizeSplit
+)
+
+// EventTooLargeError is returned for an event which can't be sent
+// because its encoded size exceeds the limit of the transports
+type EventTooLargeError struct {
+	Name  string // the event name
+	Size  int    // the encoded size
+	Limit int    // the max size the transports accept
+}
+
+func (e *EventTooLargeError) Error() string {
+	return fmt.Sprintf("lwes event %q of %d bytes exceeds the limit of %d bytes", e.Name, e.Size, e.Limit)
+}
+
+// clone a new event with the same key, value pairs in the same order
+func (lwe *LwesEvent) clone() *LwesEvent {
+	c := &LwesEvent{
+		Name:      lwe.Name,
+		Attrs:     make(map[string]interface{}, len(lwe.Attrs)),
+		attr_keys: make([]string, 0, len(lwe.attr_keys)),
+	}
+	for _, k := range lwe.attr_keys {
+		if _, ok := c.Attrs[k]; !ok {
+			c.attr_keys = append(c.attr_keys, k)
+		}
+		c.Attrs[k] = lwe.Attrs[k]
+	}
+	return c
+}
+
+// Truncate returns a copy of the event fitting in limit bytes by cutting
+// the longest string attributes, or the event itself if it already fits;
+// the strings are cut on utf-8 boundaries
+func (lwe *LwesEvent) Truncate(limit int) (*LwesEvent, error) {
+	size := lwe.Size()
+	if size <= limit {
+		return lwe, nil
+	}
+
+	t := lwe.clone()
+	keys := make([]string, 0, len(t.attr_keys))
+	for _, k := range t.attr_keys {
+		if v, ok := t.Attrs[k].(string); ok && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	// longest first
+	sort.SliceStable(keys, func(i, j int) bool {
+		return len(t.Attrs[keys[i]].(string)) > len(t.Attrs[keys[j]].(string))
+	})
+
+	for _, k := range keys {
+		v := t.Attrs[k].(string)
+		l := len(v) - (size - limit)
+		if l < 0 {
+			l = 0
+		}
+		for l > 0 && !utf8.RuneStart(v[l]) {
+			l--
+		}
+		t.Attrs[k] = v[:l]
+
+		if size = t.Size(); size <= limit {
+			return t, nil
+		}
+	}
+
+	return nil, &EventTooLargeError{Name: lwe.Name, Size: size, Limit: limit}
+}
+
+// splitIndex splits a key like "k12" into "k" and 12
+func splitIndex(key string) (string, int, bool) {
+	i := len(key)
+	for i > 0 && '0' <= key[i-1] && key[i-1] <= '9' {
+		i--
+	}
+	if i == 0 || i == len(key) {
+		return "", 0, false
+	}
+	idx, err := strconv.Atoi(key[i:])
+	if err != nil {
+		return "", 0, false
+	}
+	return key[:i], idx, true
+}
+
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case uint16:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case byte:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// sameInt returns n of the integer type of v, one of toInt
+func sameInt(v interface{}, n int) interface{} {
+	switch v.(type) {
+	case int16:
+		return int16(n)
+	case uint32:
+		return uint32(n)
+	case int32:
+		return int32(n)
+	case uint64:
+		return uint64(n)
+	case int64:
+		return int64(n)
+	case byte:
+		return byte(n)
+	}
+	return uint16(n)
+}
+
+// Split spreads the indexed attributes counted by countKey over as many
+// events as needed to fit each in limit bytes, following the MonDemand
+// convention: "num" counts k0, v0, t0, k1, ... and "ctxt_num" counts
+// ctxt_k0, ctxt_v0, ...; so the indexed keys of a countKey ending with
+// "num" have the prefix of the countKey without "num" and no other "_"
+// after it, and the ones of another countKey, like "count" of item0,
+// item1, ..., have no "_" at all.
+// The other attributes are repeated in every event, and the indexes
+// start over from 0 in each event with countKey set to their count, of
+// the integer type of the original count.
+func (lwe *LwesEvent) Split(countKey string, limit int) ([]*LwesEvent, error) {
+	size := lwe.Size()
+	if size <= limit {
+		return []*LwesEvent{lwe}, nil
+	}
+
+	num, ok := toInt(lwe.Attrs[countKey])
+	if !ok || num == 0 {
+		return nil, &EventTooLargeError{Name: lwe.Name, Size: size, Limit: limit}
+	}
+
+	// find the prefixes of the indexed keys
+	var ns string
+	if strings.HasSuffix(countKey, "num") {
+		ns = strings.TrimSuffix(countKey, "num")
+	}
+	indexes := make(map[string]int)
+	for _, k := range lwe.attr_keys {
+		prefix, idx, ok := splitIndex(k)
+		if ok && idx < num && strings.HasPrefix(prefix, ns) && !strings.Contains(prefix[len(ns):], "_") {
+			indexes[prefix]++
+		}
+	}
+	var prefixes []string
+	for _, k := range lwe.attr_keys {
+		prefix, idx, ok := splitIndex(k)
+		// a prefix counts only with all of its indexes present
+		if ok && idx == 0 && indexes[prefix] == num {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil, &EventTooLargeError{Name: lwe.Name, Size: size, Limit: limit}
+	}
+	isIndexed := make(map[string]bool, len(prefixes)*num)
+	for _, prefix := range prefixes {
+		for i := 0; i < num; i++ {
+			isIndexed[prefix+strconv.Itoa(i)] = true
+		}
+	}
+
+	base := &LwesEvent{Name: lwe.Name, Attrs: make(map[string]interface{})}
+	for _, k := range lwe.attr_keys {
+		if !isIndexed[k] {
+			base.Set(k, lwe.Attrs[k])
+		}
+	}
+	count := lwe.Attrs[countKey]
+	base.Attrs[countKey] = sameInt(count, 0)
+	baseSize := base.Size()
+
+	var parts []*LwesEvent
+	part, partSize, n := base.clone(), baseSize, 0
+	for i := 0; i < num; i++ {
+		// the size with the original index is an upper bound of the renumbered
+		groupSize := 0
+		for _, prefix := range prefixes {
+			key := prefix + strconv.Itoa(i)
+			groupSize += attrSize(key, lwe.Attrs[key])
+		}
+		if baseSize+groupSize > limit {
+			return nil, &EventTooLargeError{Name: lwe.Name, Size: baseSize + groupSize, Limit: limit}
+		}
+		if partSize+groupSize > limit {
+			part.Attrs[countKey] = sameInt(count, n)
+			parts = append(parts, part)
+			part, partSize, n = base.clone(), baseSize, 0
+		}
+		for _, prefix := range prefixes {
+			part.Set(prefix+strconv.Itoa(n), lwe.Attrs[prefix+strconv.Itoa(i)])
+		}
+		partSize += groupSize
+		n++
+	}
+	part.Attrs[countKey] = sameInt(count, n)
+	parts = append(parts, part)
+
+	return parts, nil
+}
@@ -0,0 +1,196 @@
+package lwes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type bufConn struct {
+	packets [][]byte
+}
+
+func (c *bufConn) Write(p []byte) (int, error) {
+	c.packets = append(c.packets, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func (c *bufConn) Close() error { return nil }
+
+func (c *bufConn) MaxEventSize() int { return 1000 }
+
+func newStatsEvent(num int) *LwesEvent {
+	lwe := NewLwesEvent("MonDemand::StatsMsg")
+	lwe.Set("prog_id", "lwes-test")
+	lwe.Set("ctxt_num", uint16(1))
+	lwe.Set("ctxt_k0", "host")
+	lwe.Set("ctxt_v0", "localhost")
+	lwe.Set("num", uint16(num))
+	for i := 0; i < num; i++ {
+		lwe.Set(fmt.Sprint("t", i), "counter")
+		lwe.Set(fmt.Sprint("k", i), fmt.Sprint("metric_with_a_long_name_", i))
+		lwe.Set(fmt.Sprint("v", i), int64(i))
+	}
+	return lwe
+}
+
+func TestMarshalLongString(t *testing.T) {
+	lwe := NewLwesEvent("Test::Event")
+	lwe.Set("long", strings.Repeat("x", 70000))
+	buf, err := lwe.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != lwe.Size() {
+		t.Fatalf("encoded %d bytes, but Size is %d", len(buf), lwe.Size())
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	lwe := NewLwesEvent("Test::Event")
+	lwe.Set("short", "keep me")
+	lwe.Set("long", strings.Repeat("é", 1000))
+
+	tr, err := lwe.Truncate(500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Size() > 500 {
+		t.Fatalf("truncated size %d over the limit", tr.Size())
+	}
+	if tr.Attrs["short"] != "keep me" {
+		t.Fatalf("expected the short string kept, got %q", tr.Attrs["short"])
+	}
+	if long := tr.Attrs["long"].(string); !strings.HasPrefix(lwe.Attrs["long"].(string), long) || len(long)%2 != 0 {
+		t.Fatalf("expected the long string cut on a rune boundary, got %d bytes", len(long))
+	}
+	if len(lwe.Attrs["long"].(string)) != 2000 {
+		t.Fatal("expected the original event unchanged")
+	}
+
+	if _, err := lwe.Truncate(10); !errors.As(err, new(*EventTooLargeError)) {
+		t.Fatalf("expected an EventTooLargeError, got %v", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	lwe := newStatsEvent(100)
+	parts, err := lwe.Split("num", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) < 2 {
+		t.Fatalf("expected multiple parts, got %d", len(parts))
+	}
+
+	seen := 0
+	for _, part := range parts {
+		buf, err := part.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buf) > 1000 {
+			t.Fatalf("part of %d bytes over the limit", len(buf))
+		}
+		if part.Attrs["prog_id"] != "lwes-test" || part.Attrs["ctxt_v0"] != "localhost" {
+			t.Fatalf("expected the other attributes repeated, got %v", part.Attrs)
+		}
+		num := int(part.Attrs["num"].(uint16))
+		for i := 0; i < num; i++ {
+			if part.Attrs[fmt.Sprint("v", i)] != int64(seen) {
+				t.Fatalf("expected v%d = %d, got %v", i, seen, part.Attrs[fmt.Sprint("v", i)])
+			}
+			seen++
+		}
+	}
+	if seen != 100 {
+		t.Fatalf("expected all 100 metrics in the parts, got %d", seen)
+	}
+}
+
+func TestEmitOversize(t *testing.T) {
+	c := &bufConn{}
+	em := NewEmitter(c)
+
+	lwe := newStatsEvent(100)
+	var tooLarge *EventTooLargeError
+	if err := em.Emit(lwe); !errors.As(err, &tooLarge) || tooLarge.Name != lwe.Name {
+		t.Fatalf("expected an EventTooLargeError, got %v", err)
+	}
+	if len(c.packets) != 0 {
+		t.Fatal("expected nothing written")
+	}
+
+	em.SetOversizePolicy(OversizeSplit)
+	if err := em.Emit(lwe); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.packets) < 2 {
+		t.Fatalf("expected multiple packets, got %d", len(c.packets))
+	}
+	for _, p := range c.packets {
+		if len(p) > 1000 || !bytes.Contains(p, []byte("MonDemand::StatsMsg")) {
+			t.Fatalf("unexpected packet of %d bytes", len(p))
+		}
+	}
+}
+
+func TestEmitOversizeSplitKey(t *testing.T) {
+	c := &bufConn{}
+	em := NewEmitter(c)
+	em.SetOversizePolicy(OversizeSplit)
+	em.SetSplitKey("count")
+
+	lwe := NewLwesEvent("Test::Items")
+	lwe.Set("count", int32(100))
+	for i := 0; i < 100; i++ {
+		lwe.Set(fmt.Sprint("item", i), strings.Repeat("x", 20))
+	}
+	if err := em.Emit(lwe); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.packets) < 2 {
+		t.Fatalf("expected multiple packets, got %d", len(c.packets))
+	}
+	total := 0
+	for _, p := range c.packets {
+		part := new(LwesEvent)
+		if err := part.UnmarshalBinary(p); err != nil {
+			t.Fatal(err)
+		}
+		n, ok := part.Attrs["count"].(int32)
+		if !ok {
+			t.Fatalf("expected the count kept an int32, got %T", part.Attrs["count"])
+		}
+		total += int(n)
+	}
+	if total != 100 {
+		t.Fatalf("expected the 100 items in the parts, got %d", total)
+	}
+}
+
+func TestSetReplaces(t *testing.T) {
+	lwe := NewLwesEvent("Test::Event")
+	lwe.Set("a", int64(1))
+	lwe.Set("b", int64(2))
+	lwe.Set("a", int64(3))
+
+	buf, err := Marshal(lwe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(LwesEvent)
+	if err := got.UnmarshalBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	got.Enumerate(func(key string, _ interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if strings.Join(keys, ",") != "a,b" || got.Attrs["a"] != int64(3) {
+		t.Fatalf("expected a = 3 replaced in its order, got %v %v", keys, got.Attrs)
+	}
+}
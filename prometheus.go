@@ -0,0 +1,164 @@
+package lwes
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lwes/lwes-go/internal/stattag"
+)
+
+// metricsReporter is implemented by the servers of the package, to
+// report a snapshot of their metrics like EnableMetricsReport does
+type metricsReporter interface {
+	reportMetrics(reportFunc func(string, interface{}))
+}
+
+// MetricsHandler is an http.Handler exposing the metrics of servers and
+// emitters in the Prometheus text format, without the Prometheus client.
+//
+// The metrics reported as "lwes-events" are named like
+// lwes_events_packets_received_total, "lwes-tcp" like lwes_tcp_..., and
+// "lwes-client:<addr>" like lwes_client_... with a client label; all
+// of them are labeled with the listen address of their server. The
+// metrics of an emitter are named like lwes_emitter_events_emitted_total
+// and labeled with the emitter name. The metrics structs added with
+// AddMetrics are named by their name like the report names.
+type MetricsHandler struct {
+	mutex    sync.Mutex
+	servers  []Server
+	emitters []namedEmitter
+	structs  []namedMetrics
+}
+
+type namedEmitter struct {
+	name string
+	em   *Emitter
+}
+
+type namedMetrics struct {
+	name     string
+	snapshot func() interface{}
+}
+
+func NewMetricsHandler() *MetricsHandler {
+	return &MetricsHandler{}
+}
+
+// AddServer exposes the metrics of the server
+func (h *MetricsHandler) AddServer(s Server) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.servers = append(h.servers, s)
+}
+
+// AddEmitter exposes the metrics of the emitter under the name
+func (h *MetricsHandler) AddEmitter(name string, em *Emitter) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.emitters = append(h.emitters, namedEmitter{name, em})
+}
+
+// AddMetrics exposes the tagged fields of the metrics struct returned by
+// snapshot, like the one of a program using the package; the name
+// "lwes-relay" names them like lwes_relay_events_forwarded_total
+func (h *MetricsHandler) AddMetrics(name string, snapshot func() interface{}) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.structs = append(h.structs, namedMetrics{name, snapshot})
+}
+
+// metricFamily is the samples of a metric name, exposed together
+type metricFamily struct {
+	typ     string
+	samples []string
+}
+
+type metricFamilies map[string]*metricFamily
+
+func (fs metricFamilies) add(prefix string, labels string, v interface{}) {
+	stattag.Enumerate(v, func(key, typ string, value int64) {
+		name := prefix + key
+		if typ != "gauge" {
+			typ = "counter"
+			name += "_total"
+		}
+		f, ok := fs[name]
+		if !ok {
+			f = &metricFamily{typ: typ}
+			fs[name] = f
+		}
+		sample := name
+		if labels != "" {
+			sample += "{" + labels + "}"
+		}
+		f.samples = append(f.samples, sample+" "+strconv.FormatInt(value, 10))
+	})
+}
+
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	servers := append([]Server(nil), h.servers...)
+	emitters := append([]namedEmitter(nil), h.emitters...)
+	structs := append([]namedMetrics(nil), h.structs...)
+	h.mutex.Unlock()
+
+	families := make(metricFamilies)
+	for _, s := range servers {
+		reporter, ok := s.(metricsReporter)
+		if !ok {
+			continue
+		}
+		listen := promLabel("listen", s.Addr().String())
+		reporter.reportMetrics(func(name string, v interface{}) {
+			labels := listen
+			if i := strings.IndexByte(name, ':'); i >= 0 {
+				labels += "," + promLabel("client", name[i+1:])
+				name = name[:i]
+			}
+			families.add(promName(name)+"_", labels, v)
+		})
+	}
+	for _, e := range emitters {
+		families.add("lwes_emitter_", promLabel("emitter", e.name), e.em.Metrics())
+	}
+	for _, m := range structs {
+		families.add(promName(m.name)+"_", "", m.snapshot())
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		bw.WriteString("# TYPE " + name + " " + f.typ + "\n")
+		for _, sample := range f.samples {
+			bw.WriteString(sample + "\n")
+		}
+	}
+	bw.Flush()
+}
+
+// promName maps a report name like "lwes-events" to a valid metric name
+func promName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promLabel(name, value string) string {
+	return name + `="` + promLabelEscaper.Replace(value) + `"`
+}
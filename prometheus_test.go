@@ -0,0 +1,76 @@
+package lwes
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	tr, src := NewPipe(10)
+	server := NewServer(src)
+	out := server.WaitLwesMode(1)
+	defer server.Stop()
+
+	em := NewEmitter(tr)
+	const total = 3
+	for i := 0; i < total; i++ {
+		if err := em.Emit(NewLwesEvent("Test::Event")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < total; i++ {
+		select {
+		case <-out:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received only %d of %d events", i, total)
+		}
+	}
+
+	h := NewMetricsHandler()
+	h.AddServer(server)
+	h.AddEmitter(`test "em"`, em)
+	h.AddMetrics("lwes-relay", func() interface{} {
+		return struct {
+			EventsForwarded int64 `mondemand_stat:"events_forwarded"`
+		}{7}
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	listen := promLabel("listen", server.Addr().String())
+	for _, want := range []string{
+		"# TYPE lwes_events_packets_received_total counter\n",
+		"lwes_events_packets_received_total{" + listen + "} 3\n",
+		"# TYPE lwes_events_queue_size gauge\n",
+		"# TYPE lwes_emitter_events_emitted_total counter\n",
+		`lwes_emitter_events_emitted_total{emitter="test \"em\""} 3` + "\n",
+		"# TYPE lwes_relay_events_forwarded_total counter\nlwes_relay_events_forwarded_total 7\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in the exposition:\n%s", want, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+}
+
+func TestMetricsHandlerStopped(t *testing.T) {
+	_, src := NewPipe(10)
+	server := NewServer(src)
+	addr := server.Addr()
+
+	h := NewMetricsHandler()
+	h.AddServer(server)
+	server.Stop()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if want := promLabel("listen", addr.String()); !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("expected %q in the exposition:\n%s", want, rec.Body.String())
+	}
+}
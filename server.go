@@ -24,6 +24,19 @@ type Server interface {
 	EnableMetricsReport(time.Duration, func(string, interface{}))
 }
 
+// LwesModeServer is a Server decoding the events with a LwesModeConfig,
+// like the servers of the package; check it with a type assertion
+type LwesModeServer interface {
+	Server
+	WaitLwesModeWith(LwesModeConfig) <-chan *LwesEvent
+}
+
+// MetricsSinkSetter is implemented by the servers of the package and the
+// Emitter pushing the updates of their metrics to a MetricsSink
+type MetricsSinkSetter interface {
+	SetMetricsSink(MetricsSink)
+}
+
 // ReadBuf is a structure that holds the bytes to read into as well as the number of bytes
 // that was read. The slice is typically pre-allocated to the max packet size and the buffers
 // themselves are polled to avoid memory allocations for every new inbound message.
@@ -31,23 +44,58 @@ type readBuf struct {
 	buf  []byte
 	n    int
 	pool *sync.Pool
+
+	addr     net.Addr  // the sender, if known by the source
+	received time.Time // when the packet was read
+
+	wait *sync.WaitGroup // the queue of the server, till the buffer is done
 }
 
+// Done must be called by the consumer after using the buffer, to put it
+// back to the pool
 func (b *readBuf) Done() {
+	if b.wait != nil {
+		b.wait.Done()
+		b.wait = nil
+	}
 	b.n = 0
+	b.addr = nil
+	b.received = time.Time{}
 	b.pool.Put(b)
 }
 
+// packetReader is a source which knows the sender of each packet,
+// like the *net.UDPConn
+type packetReader interface {
+	ReadFrom(p []byte) (int, net.Addr, error)
+}
+
 // overwrite the ReadFrom to read one packet only
 func (b *readBuf) ReadFrom(r io.Reader) (int64, error) {
-	n, err := r.Read(b.buf[b.n:])
-	if err != nil {
-		return 0, nil
+	var (
+		n   int
+		err error
+	)
+	if pr, ok := r.(packetReader); ok {
+		n, b.addr, err = pr.ReadFrom(b.buf[b.n:])
+	} else {
+		n, err = r.Read(b.buf[b.n:])
 	}
 	b.n = b.n + n
+	if err != nil {
+		return int64(n), err
+	}
+	b.received = time.Now()
 	return int64(n), nil
 }
 
+// Addr returns the sender of the packet, or nil if the source doesn't
+// know it
+func (b *readBuf) Addr() net.Addr { return b.addr }
+
+// ReceivedAt returns when the packet was read
+func (b *readBuf) ReceivedAt() time.Time { return b.received }
+
 func (b *readBuf) Write(p []byte) (n int, err error) {
 	return copy(b.buf[b.n:], p), nil
 }
@@ -64,3 +112,10 @@ func NewFixedBuffer(pool *sync.Pool, size int) *readBuf {
 		}
 	}
 }
+
+var (
+	_ LwesModeServer    = (*bufferedServer)(nil)
+	_ LwesModeServer    = (*tcpServer)(nil)
+	_ MetricsSinkSetter = (*bufferedServer)(nil)
+	_ MetricsSinkSetter = (*Emitter)(nil)
+)
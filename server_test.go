@@ -2,9 +2,13 @@ package lwes
 
 import (
 	"fmt"
+	"net"
 	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/lwes/lwes-go/internal/stattag"
 )
 
 func TestBufferRetention(t *testing.T) {
@@ -39,3 +43,85 @@ func TestBufferMultWrite(t *testing.T) {
 		t.Fatalf("Unexpected written message: %s != %s", string(buffer.Bytes()), expected)
 	}
 }
+
+func TestDataChanSender(t *testing.T) {
+	server, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := server.DataChan()
+
+	c, err := net.Dial("udp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	before := time.Now()
+	c.Write([]byte("test"))
+
+	select {
+	case rb := <-data:
+		if rb.Addr().String() != c.LocalAddr().String() {
+			t.Fatalf("got sender %v, want %v", rb.Addr(), c.LocalAddr())
+		}
+		if rb.ReceivedAt().Before(before) {
+			t.Fatalf("got receipt time %v before sending at %v", rb.ReceivedAt(), before)
+		}
+		rb.Done()
+	case <-time.After(5 * time.Second):
+		t.Fatal("no packet received")
+	}
+
+	// the Done of the consumer lets the server stop
+	stopped := make(chan struct{})
+	go func() {
+		server.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server didn't stop in the DataChan mode")
+	}
+}
+
+func TestServerNames(t *testing.T) {
+	tr, src := NewPipe(10)
+	server := NewServer(src)
+	f, err := CompileFilter(`i > 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := server.(LwesModeServer).WaitLwesModeWith(LwesModeConfig{Workers: 1, Names: []string{"Test::A", "Test::C"}, Filter: f})
+	defer server.Stop()
+
+	em := NewEmitter(tr)
+	for i, name := range []string{"Test::A", "Test::B", "Test::A", "Test::C"} {
+		lwe := NewLwesEvent(name)
+		lwe.Set("i", int64(i))
+		em.Emit(lwe)
+	}
+
+	for _, want := range []string{"Test::A", "Test::C"} {
+		select {
+		case lwe := <-out:
+			if lwe.Name != want {
+				t.Fatalf("got %v, want %s", lwe, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+		}
+	}
+
+	got := make(map[string]int64)
+	server.(metricsReporter).reportMetrics(func(name string, v interface{}) {
+		stattag.Enumerate(v, func(key, _ string, value int64) {
+			got[key] = value
+		})
+	})
+	// Test::B is skipped by its name, and the first Test::A filtered
+	if got["packets_skipped"] != 1 || got["packets_filtered"] != 1 || got["packets_decoded"] != 3 {
+		t.Fatalf("got %d skipped, %d filtered and %d decoded, want 1, 1 and 3",
+			got["packets_skipped"], got["packets_filtered"], got["packets_decoded"])
+	}
+}
@@ -0,0 +1,230 @@
+package lwes
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// each lwes event on a TCP stream is prefixed by its length
+	// as a 4 bytes big endian unsigned integer
+	frameHeaderSize = 4
+
+	// the max size of a single framed lwes event; the lwes encoding
+	// itself allows long strings which exceed the UDP datagram limit
+	MAX_FRAME_SIZE = 16 * 1024 * 1024
+
+	defaultTCPBufferSize   = 4 * 1024 * 1024
+	defaultTCPWriteTimeout = 5 * time.Second
+	minTCPBackoff          = 100 * time.Millisecond
+	maxTCPBackoff          = 30 * time.Second
+)
+
+var (
+	errFrameTooLarge = errors.New("lwes frame too large")
+	errConnClosed    = errors.New("lwes connection closed")
+)
+
+// appendFrame appends the length prefixed event to the buf
+func appendFrame(buf, event []byte) []byte {
+	var hdr [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(event)))
+	buf = append(buf, hdr[:]...)
+	return append(buf, event...)
+}
+
+// readFrameHeader reads the length prefix of the next event on the stream
+func readFrameHeader(r io.Reader, max int) (int, error) {
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n > uint32(max) {
+		return 0, errFrameTooLarge
+	}
+	return int(n), nil
+}
+
+// tcpConn is an emitter connection over TCP; it reconnects with
+// exponential backoff and keeps the events in memory (up to a max
+// number of bytes, dropping the oldest) while disconnected.
+//
+// An event which failed in the middle of writing is sent again after
+// reconnecting, so the delivery is at least once.
+type tcpConn struct {
+	addrport string
+
+	mutex        sync.Mutex
+	conn         net.Conn
+	pending      [][]byte // framed events waiting for a connection
+	pendingBytes int
+	maxPending   int
+	dropped      int64
+	closed       bool
+
+	redial chan struct{}
+	done   chan struct{}
+}
+
+func dialTCP(addrport string, bufsize int) *tcpConn {
+	if bufsize <= 0 {
+		bufsize = defaultTCPBufferSize
+	}
+	c := &tcpConn{
+		addrport:   addrport,
+		maxPending: bufsize,
+		redial:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	go c.dialer()
+	c.kick()
+	return c
+}
+
+// kick the dialer without blocking
+func (c *tcpConn) kick() {
+	select {
+	case c.redial <- struct{}{}:
+	default:
+	}
+}
+
+func (c *tcpConn) dialer() {
+	backoff := minTCPBackoff
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.redial:
+		}
+
+		for {
+			nc, err := net.DialTimeout("tcp", c.addrport, defaultTCPWriteTimeout)
+			if err == nil && c.attach(nc) {
+				backoff = minTCPBackoff
+				break
+			}
+			if err != nil {
+				log.Printf("failed to dial %q: %v, retry in %s\n", c.addrport, err, backoff)
+			}
+
+			select {
+			case <-c.done:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxTCPBackoff {
+				backoff = maxTCPBackoff
+			}
+		}
+	}
+}
+
+// attach a new connection and flush the pending events over it;
+// it returns false if the connection failed while flushing
+func (c *tcpConn) attach(nc net.Conn) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		nc.Close()
+		return true
+	}
+
+	c.conn = nc
+	for len(c.pending) > 0 {
+		frame := c.pending[0]
+		if err := c.writeLocked(frame); err != nil {
+			return false
+		}
+		c.pending[0] = nil
+		c.pending = c.pending[1:]
+		c.pendingBytes -= len(frame)
+	}
+	c.pending = nil
+	log.Printf("connected to %q\n", c.addrport)
+	return true
+}
+
+func (c *tcpConn) writeLocked(frame []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(defaultTCPWriteTimeout))
+	if _, err := c.conn.Write(frame); err != nil {
+		log.Printf("failed to write to %q: %v\n", c.addrport, err)
+		c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (c *tcpConn) enqueueLocked(frame []byte) {
+	c.pending = append(c.pending, frame)
+	c.pendingBytes += len(frame)
+	for c.pendingBytes > c.maxPending && len(c.pending) > 0 {
+		c.pendingBytes -= len(c.pending[0])
+		c.pending[0] = nil
+		c.pending = c.pending[1:]
+		c.dropped++
+	}
+}
+
+// Write sends one event as a frame, or buffers it while disconnected
+func (c *tcpConn) Write(p []byte) (int, error) {
+	if len(p) > MAX_FRAME_SIZE {
+		return 0, errFrameTooLarge
+	}
+	frame := appendFrame(make([]byte, 0, frameHeaderSize+len(p)), p)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return 0, errConnClosed
+	}
+
+	if c.conn != nil {
+		if err := c.writeLocked(frame); err == nil {
+			return len(p), nil
+		}
+		c.kick()
+	}
+
+	c.enqueueLocked(frame)
+	return len(p), nil
+}
+
+// droppedEvents is the number of the oldest events dropped from the
+// full buffer so far
+func (c *tcpConn) droppedEvents() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.dropped
+}
+
+// Close the connection; the events still pending are discarded
+func (c *tcpConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+
+	if len(c.pending) > 0 {
+		log.Printf("discarding %d pending events to %q\n", len(c.pending), c.addrport)
+	}
+	c.pending = nil
+
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
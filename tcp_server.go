@@ -0,0 +1,270 @@
+package lwes
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TCPServerConfig holds the limits of a TCP lwes server; zero values
+// mean the defaults, or unlimited for the connection counts
+type TCPServerConfig struct {
+	MaxConns      int           // max concurrent connections
+	MaxConnsPerIP int           // max concurrent connections from a single client IP
+	IdleTimeout   time.Duration // close a connection which sent nothing for this long
+
+	// MaxEventSize is the max size of a framed event, a larger one
+	// closes the connection; the default MAX_PACKET_SIZE is the limit
+	// of the lwes-tcp transport of the Emitter
+	MaxEventSize int
+}
+
+const defaultTCPIdleTimeout = 5 * time.Minute
+
+type tcpServer struct {
+	*bufferedServer
+
+	cfg      TCPServerConfig
+	listener net.Listener
+
+	connsLock sync.Mutex
+	conns     map[*tcpClient]struct{}
+	connsByIP map[string]int
+	connwait  sync.WaitGroup
+
+	// the conns metrics are pushed to the sink too, the per client
+	// ones are not
+	connMetrics struct {
+		ConnsActive   int64 `mondemand_stat:"conns_active,gauge"`
+		ConnsAccepted int64 `mondemand_stat:"conns_accepted"`
+		ConnsRejected int64 `mondemand_stat:"conns_rejected"`
+		ConnsIdle     int64 `mondemand_stat:"conns_idle_closed"`
+		AcceptError   int64 `mondemand_stat:"conns_accept_error"`
+	}
+}
+
+type tcpClient struct {
+	conn net.Conn
+	ip   string
+
+	metrics struct {
+		BytesReceived   int64 `mondemand_stat:"bytes_received"`
+		PacketsReceived int64 `mondemand_stat:"packets_received"`
+		PacketsDropped  int64 `mondemand_stat:"packets_dropped"`
+		PacketsInvalid  int64 `mondemand_stat:"packets_invalid"`
+	}
+}
+
+// listen on the TCP "addr:port" form for length-prefixed lwes events,
+// as sent by the lwes-tcp transport of the Emitter;
+// return a server with the Server interface methods
+func ListenTCP(addrport string, cfg TCPServerConfig) (Server, error) {
+	ln, err := net.Listen("tcp", addrport)
+	if err != nil {
+		log.Println("failed to listen:", addrport)
+		return nil, err
+	}
+	log.Println("start listening on:", ln.Addr())
+
+	if cfg.MaxEventSize <= 0 {
+		cfg.MaxEventSize = MAX_PACKET_SIZE
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = defaultTCPIdleTimeout
+	}
+
+	s := &tcpServer{
+		bufferedServer: newBufferedServer(addrport, make(chan *readBuf, DEFAULT_QUEUE_SIZE), cfg.MaxEventSize),
+		cfg:            cfg,
+		listener:       ln,
+		conns:          make(map[*tcpClient]struct{}),
+		connsByIP:      make(map[string]int),
+	}
+
+	go s.Serve()
+
+	// wait it started before returning
+	<-s.startstop
+
+	return s, nil
+}
+
+func (s *tcpServer) Serve() {
+	if atomic.SwapUint32(&s.serving, 1) != 0 {
+		return
+	}
+	s.startstop <- struct{}{}
+
+	for s.IsServing() {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			if !s.IsServing() {
+				break
+			}
+			s.sink.count(&s.connMetrics.AcceptError, "conns_accept_error", 1)
+
+			log.Printf("failed to accept: %v\n", err)
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		c := s.admit(nc)
+		if c == nil {
+			nc.Close()
+			continue
+		}
+		go s.serveConn(c)
+	}
+
+	s.startstop <- struct{}{}
+}
+
+// admit registers a new client connection if it's within the limits
+func (s *tcpServer) admit(nc net.Conn) *tcpClient {
+	ip := nc.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	s.connsLock.Lock()
+	defer s.connsLock.Unlock()
+
+	if (s.cfg.MaxConns > 0 && len(s.conns) >= s.cfg.MaxConns) ||
+		(s.cfg.MaxConnsPerIP > 0 && s.connsByIP[ip] >= s.cfg.MaxConnsPerIP) {
+		s.sink.count(&s.connMetrics.ConnsRejected, "conns_rejected", 1)
+		return nil
+	}
+
+	c := &tcpClient{conn: nc, ip: ip}
+	s.conns[c] = struct{}{}
+	s.connsByIP[ip]++
+	s.connwait.Add(1)
+
+	s.sink.count(&s.connMetrics.ConnsAccepted, "conns_accepted", 1)
+	s.sink.gauge(&s.connMetrics.ConnsActive, "conns_active", int64(len(s.conns)))
+	return c
+}
+
+func (s *tcpServer) release(c *tcpClient) {
+	c.conn.Close()
+
+	s.connsLock.Lock()
+	delete(s.conns, c)
+	if s.connsByIP[c.ip]--; s.connsByIP[c.ip] <= 0 {
+		delete(s.connsByIP, c.ip)
+	}
+	s.sink.gauge(&s.connMetrics.ConnsActive, "conns_active", int64(len(s.conns)))
+	s.connsLock.Unlock()
+
+	s.connwait.Done()
+}
+
+// serveConn reads the framed events of one client till it's closed
+func (s *tcpServer) serveConn(c *tcpClient) {
+	defer s.release(c)
+
+	for s.IsServing() {
+		if s.cfg.IdleTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(s.cfg.IdleTimeout))
+		}
+
+		n, err := readFrameHeader(c.conn, s.maxPacketSize)
+		if err != nil {
+			s.connError(c, err)
+			return
+		}
+
+		readBuf := NewFixedBuffer(&s.readBufPool, s.maxPacketSize)
+		if _, err = io.ReadFull(c.conn, readBuf.buf[:n]); err != nil {
+			readBuf.Done()
+			s.connError(c, err)
+			return
+		}
+		readBuf.n = n
+		readBuf.addr = c.conn.RemoteAddr()
+		readBuf.received = time.Now()
+
+		atomic.AddInt64(&c.metrics.BytesReceived, int64(n))
+		atomic.AddInt64(&c.metrics.PacketsReceived, 1)
+
+		if !s.enqueue(readBuf, int64(n)) {
+			readBuf.Done()
+
+			atomic.AddInt64(&c.metrics.PacketsDropped, 1)
+		}
+	}
+}
+
+func (s *tcpServer) connError(c *tcpClient, err error) {
+	switch nerr, _ := err.(net.Error); {
+	case err == io.EOF:
+		// closed by the client
+	case errors.Is(err, errFrameTooLarge):
+		atomic.AddInt64(&c.metrics.PacketsInvalid, 1)
+		s.sink.count(&s.metrics.PacketsInvalid, "packets_invalid", 1)
+		log.Printf("closing %s: %v\n", c.conn.RemoteAddr(), err)
+	case nerr != nil && nerr.Timeout():
+		s.sink.count(&s.connMetrics.ConnsIdle, "conns_idle_closed", 1)
+	case s.IsServing():
+		s.sink.count(&s.metrics.ReadError, "packets_read_error", 1)
+	}
+}
+
+// Stop stops accepting and closes all the client connections, then
+// waits until the queue is emptied by the readers
+func (s *tcpServer) Stop() {
+	if atomic.SwapUint32(&s.serving, 0) == 0 {
+		// already stopped
+		return
+	}
+
+	s.listener.Close()
+	<-s.startstop
+
+	s.connsLock.Lock()
+	for c := range s.conns {
+		c.conn.Close()
+	}
+	s.connsLock.Unlock()
+	s.connwait.Wait()
+
+	s.drain()
+}
+
+// EnableMetricsReport reports the metrics of the server as "lwes-events",
+// the connections as "lwes-tcp", and each connected client
+// as "lwes-client:<addr>"
+func (s *tcpServer) EnableMetricsReport(interval time.Duration, reportFunc func(string, interface{})) {
+	s.bufferedServer.EnableMetricsReport(interval, func(name string, metrics interface{}) {
+		reportFunc(name, metrics)
+		s.reportConnMetrics(reportFunc)
+	})
+}
+
+func (s *tcpServer) reportMetrics(reportFunc func(string, interface{})) {
+	s.bufferedServer.reportMetrics(reportFunc)
+	s.reportConnMetrics(reportFunc)
+}
+
+func (s *tcpServer) reportConnMetrics(reportFunc func(string, interface{})) {
+	s.connsLock.Lock()
+	clients := make([]*tcpClient, 0, len(s.conns))
+	for c := range s.conns {
+		clients = append(clients, c)
+	}
+	s.connsLock.Unlock()
+
+	reportFunc("lwes-tcp", snapshotMetrics(&s.connMetrics))
+
+	for _, c := range clients {
+		reportFunc("lwes-client:"+c.conn.RemoteAddr().String(), snapshotMetrics(&c.metrics))
+	}
+}
+
+func (s *tcpServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
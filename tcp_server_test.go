@@ -0,0 +1,255 @@
+package lwes
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTCPServer(t *testing.T) {
+	server, err := ListenTCP("127.0.0.1:0", TCPServerConfig{MaxConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := server.WaitLwesMode(2)
+
+	var cfg EmitterConfig
+	if err := cfg.ParseFromString("lwes-tcp:" + server.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	defer em.Close()
+
+	const total = 10
+	for i := 0; i < total; i++ {
+		lwe := NewLwesEvent("Test::Event")
+		lwe.Set("seq", int64(i))
+		em.Emit(lwe)
+	}
+
+	seen := make(map[int64]bool)
+	timeout := time.After(5 * time.Second)
+	for len(seen) < total {
+		select {
+		case lwe := <-out:
+			if lwe.Name != "Test::Event" {
+				t.Fatalf("unexpected event %v", lwe)
+			}
+			seen[lwe.Attrs["seq"].(int64)] = true
+		case <-timeout:
+			t.Fatalf("received only %d of %d events", len(seen), total)
+		}
+	}
+
+	// the second connection is over the limit, and closed by the server
+	c, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the connection over the limit to be closed")
+	}
+	c.Close()
+
+	names := make(chan string, 16)
+	server.EnableMetricsReport(10*time.Millisecond, func(name string, _ interface{}) {
+		select {
+		case names <- name:
+		default:
+		}
+	})
+	for found := false; !found; {
+		select {
+		case name := <-names:
+			found = strings.HasPrefix(name, "lwes-client:")
+		case <-timeout:
+			t.Fatal("expected metrics reported for the connected client")
+		}
+	}
+
+	server.Stop()
+	if _, ok := <-out; ok {
+		t.Fatal("expected the lwes chan closed after Stop")
+	}
+}
+
+func TestTCPServerFrameTooLarge(t *testing.T) {
+	server, err := ListenTCP("127.0.0.1:0", TCPServerConfig{MaxEventSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	c, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Write(appendFrame(nil, make([]byte, 17)))
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the connection closed on a frame too large")
+	}
+}
+
+func TestTCPEmitterLimit(t *testing.T) {
+	server, err := ListenTCP("127.0.0.1:0", TCPServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	out := server.WaitLwesMode(1)
+
+	var cfg EmitterConfig
+	if err := cfg.ParseFromString("lwes-tcp:" + server.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	defer em.Close()
+
+	// rejected by the emitter rather than closing the connection
+	large := NewLwesEvent("Test::Large")
+	large.Set("s", strings.Repeat("x", MAX_PACKET_SIZE))
+	var tooLarge *EventTooLargeError
+	if err := em.Emit(large); !errors.As(err, &tooLarge) {
+		t.Fatalf("expected an EventTooLargeError, got %v", err)
+	}
+
+	big := NewLwesEvent("Test::Big")
+	big.Set("s", strings.Repeat("x", MAX_PACKET_SIZE-100))
+	if err := em.Emit(big); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case lwe := <-out:
+		if lwe.Name != "Test::Big" {
+			t.Fatalf("unexpected event %v", lwe.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event under the limit received")
+	}
+}
+
+func TestListenTCP(t *testing.T) {
+	server, err := Listen("tcp:127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	if _, ok := server.(*tcpServer); !ok {
+		t.Fatalf("expected a TCP server, got %T", server)
+	}
+	out := server.WaitLwesMode(1)
+
+	var cfg EmitterConfig
+	if err := cfg.ParseFromString("lwes-tcp:" + server.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	defer em.Close()
+
+	if err := em.Emit(NewLwesEvent("Test::Event")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case lwe := <-out:
+		if lwe.Name != "Test::Event" {
+			t.Fatalf("unexpected event %v", lwe)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event received")
+	}
+}
+
+// the emitter buffers the events while the server is restarted, and
+// sends them in order once reconnected
+func TestTCPServerRestart(t *testing.T) {
+	server, err := ListenTCP("127.0.0.1:0", TCPServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := server.Addr().String()
+	out := server.WaitLwesMode(1)
+
+	var cfg EmitterConfig
+	if err := cfg.ParseFromString("lwes-tcp:" + addr); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	defer em.Close()
+	tc := em.conns[0].Transport.(*tcpConn)
+
+	seq := int64(0)
+	emit := func() {
+		lwe := NewLwesEvent("Test::Event")
+		lwe.Set("seq", seq)
+		if err := em.Emit(lwe); err != nil {
+			t.Fatal(err)
+		}
+		seq++
+	}
+	connected := func() bool {
+		tc.mutex.Lock()
+		defer tc.mutex.Unlock()
+		return tc.conn != nil
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); !connected(); {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the emitter connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	emit()
+	select {
+	case <-out:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the first event received")
+	}
+
+	server.Stop()
+	for range out {
+	}
+
+	// the writes accepted by the kernel before the close is noticed
+	// are lost, the following ones are buffered
+	for deadline := time.Now().Add(5 * time.Second); connected(); {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the emitter to notice the closed connection")
+		}
+		emit()
+		time.Sleep(10 * time.Millisecond)
+	}
+	buffered := seq
+	for i := 0; i < 10; i++ {
+		emit()
+	}
+
+	server, err = ListenTCP(addr, TCPServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	out = server.WaitLwesMode(1)
+
+	timeout := time.After(10 * time.Second)
+	for want := buffered; want < seq; {
+		select {
+		case lwe := <-out:
+			got := lwe.Attrs["seq"].(int64)
+			if got < buffered {
+				continue
+			}
+			if got != want {
+				t.Fatalf("expected seq %d, got %d", want, got)
+			}
+			want++
+		case <-timeout:
+			t.Fatalf("received the buffered events up to %d of %d", want, seq)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package lwes
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ParseText parses the events of a text like the output of the event
+// printers, with optional ESF types and comments from '#' to the end of
+// the line:
+//
+//	MonDemand::StatsMsg
+//	{
+//		uint16 num = 1;
+//		string k0 = "x";   # a quoted string has the Go escapes
+//		int64 v0 = 5;
+//		host = 10.0.0.1;   # untyped
+//	}
+//
+// An untyped value is a boolean, an int64, an uint64, a float64 or an
+// ipv4 address if it parses as one, and a string otherwise; the "[n]"
+// after the name in the printer output is ignored.
+func ParseText(text string) ([]*LwesEvent, error) {
+	p := textParser{text: text, line: 1}
+	var events []*LwesEvent
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return events, nil
+		}
+		lwe, err := p.parseEvent()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, lwe)
+	}
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface, for a
+// text of exactly one event
+func (lwe *LwesEvent) UnmarshalText(text []byte) error {
+	events, err := ParseText(string(text))
+	if err != nil {
+		return err
+	}
+	if len(events) != 1 {
+		return fmt.Errorf("lwes: got %d events in the text, want 1", len(events))
+	}
+	*lwe = *events[0]
+	return nil
+}
+
+type textParser struct {
+	text string
+	pos  int
+	line int
+}
+
+func (p *textParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("lwes: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *textParser) eof() bool {
+	return p.pos >= len(p.text)
+}
+
+func (p *textParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+// skipSpace skips the spaces and the comments
+func (p *textParser) skipSpace() {
+	for !p.eof() {
+		switch c := p.text[p.pos]; {
+		case c == '\n':
+			p.line++
+		case c == '#':
+			for !p.eof() && p.text[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		case c != ' ' && c != '\t' && c != '\r':
+			return
+		}
+		p.pos++
+	}
+}
+
+func isWordByte(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '{', '}', '[', ']', '=', ';', '#', '"':
+		return false
+	}
+	return true
+}
+
+// word returns the name, the key or the type at the position
+func (p *textParser) word(what string) (string, error) {
+	p.skipSpace()
+	start := p.pos
+	for !p.eof() && isWordByte(p.text[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		if p.eof() {
+			return "", p.errorf("expected %s, got the end of the text", what)
+		}
+		return "", p.errorf("expected %s, got %q", what, p.peek())
+	}
+	return p.text[start:p.pos], nil
+}
+
+func (p *textParser) expect(c byte) error {
+	p.skipSpace()
+	if p.eof() {
+		return p.errorf("expected %q, got the end of the text", c)
+	}
+	if p.text[p.pos] != c {
+		return p.errorf("expected %q, got %q", c, p.text[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+func (p *textParser) parseEvent() (*LwesEvent, error) {
+	name, err := p.word("an event name")
+	if err != nil {
+		return nil, err
+	}
+	lwe := NewLwesEvent(name)
+
+	// the number of attrs of the printer output
+	p.skipSpace()
+	if p.peek() == '[' {
+		for !p.eof() && p.text[p.pos] != ']' {
+			p.pos++
+		}
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			return lwe, nil
+		}
+		if err := p.parseAttr(lwe); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *textParser) parseAttr(lwe *LwesEvent) error {
+	typ, err := p.word("a key")
+	if err != nil {
+		return err
+	}
+	key := typ
+	p.skipSpace()
+	if p.peek() == '=' {
+		typ = ""
+	} else if key, err = p.word("a key"); err != nil {
+		return err
+	}
+	if err := p.expect('='); err != nil {
+		return err
+	}
+
+	s, quoted, err := p.value()
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if typ == "" {
+		value = inferValue(s, quoted)
+	} else if value, err = parseValue(typ, s); err != nil {
+		return p.errorf("attr %q: %v", key, err)
+	}
+	if _, ok := lwe.Attrs[key]; ok {
+		return p.errorf("duplicated attr %q", key)
+	}
+	lwe.Set(key, value)
+
+	// the ';' may be left out before the '}'
+	p.skipSpace()
+	if p.peek() == '}' {
+		return nil
+	}
+	return p.expect(';')
+}
+
+// value returns a quoted string unquoted, or the text up to the ';', the
+// '}', the comment or the end of the line trimmed
+func (p *textParser) value() (string, bool, error) {
+	p.skipSpace()
+	if p.peek() == '"' {
+		quoted, err := strconv.QuotedPrefix(p.text[p.pos:])
+		if err != nil {
+			return "", false, p.errorf("bad quoted string: %v", err)
+		}
+		p.pos += len(quoted)
+		s, _ := strconv.Unquote(quoted)
+		return s, true, nil
+	}
+
+	start := p.pos
+	for !p.eof() && strings.IndexByte(";}#\n", p.text[p.pos]) < 0 {
+		p.pos++
+	}
+	s := strings.TrimSpace(p.text[start:p.pos])
+	if s == "" {
+		return "", false, p.errorf("expected a value")
+	}
+	return s, false, nil
+}
+
+// inferValue returns an untyped value as the first type it parses as
+func inferValue(s string, quoted bool) interface{} {
+	if quoted {
+		return s
+	}
+	if s == "true" || s == "false" {
+		return s == "true"
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u
+	}
+	// not the "inf" and the "nan" of ParseFloat
+	if c := s[0]; c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9') {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	if ip := net.ParseIP(s).To4(); ip != nil && strings.Count(s, ".") == 3 {
+		return ip
+	}
+	return s
+}
+
+// parseValue parses the text of a value of the type name
+func parseValue(typ, s string) (interface{}, error) {
+	switch typ {
+	case "string", "long_string":
+		return s, nil
+	case "ip_addr":
+		ip := net.ParseIP(s).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("not an ipv4 address: %q", s)
+		}
+		return ip, nil
+	case "boolean":
+		return strconv.ParseBool(s)
+	case "float":
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case "double":
+		return strconv.ParseFloat(s, 64)
+	case "uint16":
+		u, err := strconv.ParseUint(s, 10, 16)
+		return uint16(u), err
+	case "int16":
+		i, err := strconv.ParseInt(s, 10, 16)
+		return int16(i), err
+	case "uint32":
+		u, err := strconv.ParseUint(s, 10, 32)
+		return uint32(u), err
+	case "int32":
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	case "int64":
+		return strconv.ParseInt(s, 10, 64)
+	case "uint64":
+		return strconv.ParseUint(s, 10, 64)
+	case "byte":
+		u, err := strconv.ParseUint(s, 10, 8)
+		return byte(u), err
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
@@ -0,0 +1,103 @@
+package lwes
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseText(t *testing.T) {
+	events, err := ParseText(`
+# a typed one
+MonDemand::StatsMsg {
+	uint16 num = 1;
+	string k0 = "x y;\t}";
+	int64 v0 = -5;  # the value
+	ip_addr ip = 10.1.2.3;
+	boolean ok = true;
+	byte b = 255;
+	float f = 1.5;
+	double d = NaN
+}
+
+Test::Event[4]
+{
+	count = 3;
+	msg = hello world;
+	ip = 127.0.0.1;
+	ratio = 0.5;
+	big = 18446744073709551615;
+	quoted = "42";
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+
+	want := NewLwesEvent("Test::Event")
+	want.Set("count", int64(3))
+	want.Set("msg", "hello world")
+	want.Set("ip", net.IP{127, 0, 0, 1})
+	want.Set("ratio", 0.5)
+	want.Set("big", uint64(18446744073709551615))
+	want.Set("quoted", "42")
+	if !reflect.DeepEqual(events[1], want) {
+		t.Fatalf("got %v, want %v", events[1], want)
+	}
+
+	lwe := events[0]
+	var keys []string
+	lwe.Enumerate(func(key string, _ interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if lwe.Name != "MonDemand::StatsMsg" || strings.Join(keys, ",") != "num,k0,v0,ip,ok,b,f,d" ||
+		lwe.Attrs["num"] != uint16(1) || lwe.Attrs["k0"] != "x y;\t}" || lwe.Attrs["v0"] != int64(-5) ||
+		!bytes.Equal(lwe.Attrs["ip"].(net.IP), net.IP{10, 1, 2, 3}) || lwe.Attrs["ok"] != true ||
+		lwe.Attrs["b"] != byte(255) || lwe.Attrs["f"] != float32(1.5) {
+		t.Fatalf("unexpected event %v", lwe)
+	}
+
+	// the printer output parses back, but for the quotes of the strings
+	delete(want.Attrs, "quoted")
+	want.attr_keys = want.attr_keys[:len(want.attr_keys)-1]
+	var buf bytes.Buffer
+	want.FPrint(&buf)
+	var printed LwesEvent
+	if err := printed.UnmarshalText(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&printed, want) {
+		t.Fatalf("got %v, want %v", &printed, want)
+	}
+}
+
+func TestParseTextErrors(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		err  string
+	}{
+		{"E { uint16 a = 70000; }", "line 1: attr \"a\""},
+		{"E {\n a = 1;\n a = 2; }", "line 3: duplicated attr \"a\""},
+		{"E {\n int128 a = 1; }", "line 2: attr \"a\": unknown type"},
+		{"E { a = \"1\" b = 2; }", "line 1: expected ';'"},
+		{"E { a = ; }", "line 1: expected a value"},
+		{"E { a = \"x; }", "line 1: bad quoted string"},
+		{"E { a = 1;", "line 1: expected a key, got the end of the text"},
+		{"E a = 1; }", "line 1: expected '{'"},
+	} {
+		_, err := ParseText(tc.text)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("parsing %q: got %v, want an error of %q", tc.text, err, tc.err)
+		}
+	}
+
+	var lwe LwesEvent
+	if err := lwe.UnmarshalText([]byte("A {} B {}")); err == nil {
+		t.Errorf("expected an error unmarshaling two events")
+	}
+}
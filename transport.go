@@ -0,0 +1,219 @@
+package lwes
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Transport is the send side of the emitter; each Write sends one
+// encoded lwes event, and its error fails the Emit if no other
+// transport of the emitter succeeded
+type Transport interface {
+	io.WriteCloser
+
+	// MaxEventSize returns the max encoded size of an event it can send
+	MaxEventSize() int
+}
+
+// PacketSource is the receive side of the server; each Read returns
+// one encoded lwes event, and a Read past the deadline fails with
+// an error whose Timeout() is true, like a net.Conn.
+// A source returning io.EOF ends the serving.
+type PacketSource interface {
+	io.Reader
+	SetReadDeadline(t time.Time) error
+	LocalAddr() net.Addr
+	Close() error
+}
+
+// the UDP transport of the emitter
+type udpTransport struct {
+	*net.UDPConn
+}
+
+func (t udpTransport) MaxEventSize() int { return MAX_MSG_SIZE }
+
+// the limit of the TCP transport is the one the TCP listener accepts by
+// default, as a larger frame closes the connection
+func (c *tcpConn) MaxEventSize() int { return MAX_PACKET_SIZE }
+
+// stream transport writes each event with the length prefix to a stream
+type streamTransport struct {
+	mutex sync.Mutex
+	w     io.WriteCloser
+	buf   []byte
+}
+
+// NewStreamTransport returns a Transport writing the events to w,
+// each prefixed by its length the same way as the TCP transport;
+// it suits files and pipes
+func NewStreamTransport(w io.WriteCloser) Transport {
+	return &streamTransport{w: w}
+}
+
+func (t *streamTransport) Write(p []byte) (int, error) {
+	if len(p) > MAX_FRAME_SIZE {
+		return 0, errFrameTooLarge
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// write the header and the event at once
+	t.buf = appendFrame(t.buf[:0], p)
+	if _, err := t.w.Write(t.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *streamTransport) Close() error { return t.w.Close() }
+
+// the limit of the stream transport is the one of the buffers of the
+// servers reading the stream source
+func (t *streamTransport) MaxEventSize() int { return MAX_PACKET_SIZE }
+
+// stream source reads the length prefixed events from a stream
+type streamSource struct {
+	r io.ReadCloser
+}
+
+// NewStreamSource returns a PacketSource reading the events written by
+// a stream transport from r; the read deadlines are ignored
+func NewStreamSource(r io.ReadCloser) PacketSource {
+	return &streamSource{r: r}
+}
+
+// Read reads one event; an event larger than p is skipped with
+// errFrameTooLarge, the stream staying at the next one
+func (s *streamSource) Read(p []byte) (int, error) {
+	n, err := readFrameHeader(s.r, MAX_FRAME_SIZE)
+	if err != nil {
+		return 0, err
+	}
+	if n > len(p) {
+		if _, err := io.CopyN(io.Discard, s.r, int64(n)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		return 0, errFrameTooLarge
+	}
+	if _, err := io.ReadFull(s.r, p[:n]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *streamSource) SetReadDeadline(time.Time) error { return nil }
+func (s *streamSource) LocalAddr() net.Addr             { return pipeAddr("stream") }
+func (s *streamSource) Close() error                    { return s.r.Close() }
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return string(a) }
+func (a pipeAddr) String() string  { return string(a) }
+
+// the in-memory pipe shared by both of its ends
+type pipe struct {
+	packets chan []byte
+	eof     chan struct{} // closed by the transport
+	done    chan struct{} // closed by the source
+	closing sync.Once
+	stop    sync.Once
+
+	mutex    sync.Mutex
+	deadline time.Time
+}
+
+type pipeTransport struct{ *pipe }
+type pipeSource struct{ *pipe }
+
+// NewPipe returns the two ends of an in-memory pipe holding up to
+// size events: the events written to the Transport are read from the
+// PacketSource in the same order. A Write blocks while the pipe is full;
+// closing the Transport lets the source read the remaining events,
+// then io.EOF.
+func NewPipe(size int) (Transport, PacketSource) {
+	p := &pipe{
+		packets: make(chan []byte, size),
+		eof:     make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	return pipeTransport{p}, pipeSource{p}
+}
+
+func (t pipeTransport) Write(b []byte) (int, error) {
+	select {
+	case <-t.eof:
+		return 0, os.ErrClosed
+	default:
+	}
+
+	select {
+	case t.packets <- append([]byte(nil), b...):
+		return len(b), nil
+	case <-t.eof:
+		return 0, os.ErrClosed
+	case <-t.done:
+		return 0, os.ErrClosed
+	}
+}
+
+func (t pipeTransport) Close() error {
+	t.closing.Do(func() { close(t.eof) })
+	return nil
+}
+
+func (t pipeTransport) MaxEventSize() int { return MAX_MSG_SIZE }
+
+func (s pipeSource) Read(b []byte) (int, error) {
+	s.mutex.Lock()
+	deadline := s.deadline
+	s.mutex.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case p := <-s.packets:
+		return copy(b, p), nil
+	case <-s.eof:
+		// read the remaining ones before the end
+		select {
+		case p := <-s.packets:
+			return copy(b, p), nil
+		default:
+			return 0, io.EOF
+		}
+	case <-s.done:
+		return 0, os.ErrClosed
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (s pipeSource) SetReadDeadline(t time.Time) error {
+	s.mutex.Lock()
+	s.deadline = t
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s pipeSource) LocalAddr() net.Addr { return pipeAddr("pipe") }
+
+func (s pipeSource) Close() error {
+	s.stop.Do(func() { close(s.done) })
+	return nil
+}
@@ -0,0 +1,125 @@
+package lwes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestPipe(t *testing.T) {
+	tr, src := NewPipe(100)
+	em := NewEmitter(tr)
+	server := NewServer(src)
+	out := server.WaitLwesMode(1)
+
+	const total = 10
+	for i := 0; i < total; i++ {
+		lwe := NewLwesEvent("Test::Event")
+		lwe.Set("seq", int64(i))
+		if err := em.Emit(lwe); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the end of the pipe stops the server after the queued events
+	em.Close()
+
+	seq := int64(0)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case lwe, ok := <-out:
+			if !ok {
+				if seq != total {
+					t.Fatalf("received %d of %d events", seq, total)
+				}
+				return
+			}
+			if lwe.Attrs["seq"] != seq {
+				t.Fatalf("expected seq %d, got %v", seq, lwe.Attrs["seq"])
+			}
+			seq++
+		case <-timeout:
+			t.Fatal("expected the server stopped at the end of the pipe")
+		}
+	}
+}
+
+func TestPipeReadDeadline(t *testing.T) {
+	_, src := NewPipe(1)
+	src.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+
+	_, err := src.Read(make([]byte, 10))
+	if nerr, ok := err.(interface{ Timeout() bool }); !ok || !nerr.Timeout() {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestStreamTransport(t *testing.T) {
+	var stream bytes.Buffer
+	em := NewEmitter(NewStreamTransport(nopWriteCloser{&stream}))
+	for i := 0; i < 3; i++ {
+		lwe := NewLwesEvent("Test::Event")
+		lwe.Set("seq", int64(i))
+		em.Emit(lwe)
+	}
+
+	src := NewStreamSource(io.NopCloser(&stream))
+	buf := make([]byte, MAX_PACKET_SIZE)
+	for i := 0; i < 3; i++ {
+		n, err := src.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lwe := new(LwesEvent)
+		if err := lwe.UnmarshalBinary(buf[:n]); err != nil || lwe.Attrs["seq"] != int64(i) {
+			t.Fatalf("unexpected event %v, err %v", lwe, err)
+		}
+	}
+	if _, err := src.Read(buf); err != io.EOF {
+		t.Fatalf("expected io.EOF at the end, got %v", err)
+	}
+}
+
+func TestStreamTransportTooLarge(t *testing.T) {
+	var stream bytes.Buffer
+	tr := NewStreamTransport(nopWriteCloser{&stream})
+	em := NewEmitter(tr)
+
+	large := NewLwesEvent("Test::Large")
+	large.Set("s", strings.Repeat("x", 100*1024))
+	var tooLarge *EventTooLargeError
+	if err := em.Emit(large); !errors.As(err, &tooLarge) {
+		t.Fatalf("expected an EventTooLargeError, got %v", err)
+	}
+
+	// written by a stream transport of another limit, then skipped
+	event, err := Marshal(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Write(event); err != nil {
+		t.Fatal(err)
+	}
+	if err := em.Emit(NewLwesEvent("Test::Event")); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(NewStreamSource(io.NopCloser(&stream)))
+	out := server.WaitLwesMode(1)
+	select {
+	case lwe := <-out:
+		if lwe.Name != "Test::Event" {
+			t.Fatalf("unexpected event %v", lwe.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event after the large one received")
+	}
+	server.Wait()
+}
@@ -0,0 +1,150 @@
+package lwes
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+const defaultSocketPerm os.FileMode = 0666
+
+// the unix datagram transport of the emitter; it's dialled again on
+// a write error, like after the listener restarted, or while the
+// socket is missing
+type unixTransport struct {
+	path   string
+	sndbuf int
+
+	mutex  sync.Mutex
+	conn   *net.UnixConn // nil while not connected
+	closed bool
+}
+
+func newUnixTransport(path string, sndbuf int) *unixTransport {
+	t := &unixTransport{path: path, sndbuf: sndbuf}
+	if err := t.dial(); err != nil {
+		log.Printf("failed to dial %q: %v, retry on write\n", path, err)
+	}
+	return t
+}
+
+func (t *unixTransport) MaxEventSize() int { return MAX_MSG_SIZE }
+
+func (t *unixTransport) dial() error {
+	c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: t.path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	var writebuffer int = defaultSndBuf
+	if t.sndbuf != 0 {
+		writebuffer = t.sndbuf
+	}
+	if err = c.SetWriteBuffer(writebuffer); err != nil {
+		log.Printf("unable to set send buffer size: err %v:%#v\n", err, err)
+	}
+	t.conn = c
+	return nil
+}
+
+func (t *unixTransport) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return 0, errConnClosed
+	}
+	if t.conn != nil {
+		n, err := t.conn.Write(p)
+		if err == nil {
+			return n, nil
+		}
+		t.conn.Close()
+		t.conn = nil
+	}
+
+	// the first write, or the socket of the listener changed
+	if err := t.dial(); err != nil {
+		return 0, err
+	}
+	n, err := t.conn.Write(p)
+	if err != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	return n, err
+}
+
+func (t *unixTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.closed = true
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// the unix datagram source removes its socket file when closed
+type unixSource struct {
+	*net.UnixConn
+	path string
+}
+
+func (s unixSource) Close() error {
+	err := s.UnixConn.Close()
+	if rerr := os.Remove(s.path); rerr != nil && !os.IsNotExist(rerr) {
+		log.Printf("failed to remove %q: %v\n", s.path, rerr)
+	}
+	return err
+}
+
+// listen on the unix datagram socket at path, created with the perm;
+// a stale socket left at the path is replaced, but not the one of a
+// running listener, and the socket file is removed on Stop
+func ListenUnixgram(path string, perm os.FileMode) (Server, error) {
+	addr := &net.UnixAddr{Name: path, Net: "unixgram"}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode().Type() == fs.ModeSocket {
+		// only a socket refusing the connections is stale
+		c, err := net.DialUnix("unixgram", nil, addr)
+		if err == nil {
+			c.Close()
+			log.Println("failed to listen, in use:", path)
+			return nil, fmt.Errorf("%s: %w", path, syscall.EADDRINUSE)
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			os.Remove(path)
+		}
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		log.Println("failed to listen:", path)
+		return nil, err
+	}
+	src := unixSource{conn, path}
+
+	if err = os.Chmod(path, perm); err != nil {
+		src.Close()
+		return nil, err
+	}
+	log.Println("start listening on:", path)
+
+	var bufsize int = defaultRcvBuf
+	if err = conn.SetReadBuffer(bufsize); err != nil {
+		log.Printf("unable to set recv buffer size: err %v:%#v\n", err, err)
+	}
+
+	s := newBufferedServer(path, make(chan *readBuf, DEFAULT_QUEUE_SIZE), MAX_PACKET_SIZE)
+	s.start(src)
+
+	return s, nil
+}
@@ -0,0 +1,116 @@
+package lwes
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lwes.sock")
+	server, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := server.WaitLwesMode(1)
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != defaultSocketPerm {
+		t.Fatalf("expected the socket with perm %v, got %v, err %v", defaultSocketPerm, fi, err)
+	}
+
+	var cfg EmitterConfig
+	if err := cfg.ParseFromString("lwes-unix:" + path); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	defer em.Close()
+
+	lwe := NewLwesEvent("Test::Event")
+	lwe.Set("seq", int64(1))
+	if err := em.Emit(lwe); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-out:
+		if got.Name != "Test::Event" || got.Attrs["seq"] != int64(1) {
+			t.Fatalf("unexpected event %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event received")
+	}
+
+	server.Stop()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the socket removed on Stop, got %v", err)
+	}
+}
+
+func TestUnixgramRedial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lwes.sock")
+
+	// opened before the listener
+	var cfg EmitterConfig
+	if err := cfg.ParseFromString("lwes-unix:" + path); err != nil {
+		t.Fatal(err)
+	}
+	em := Open(cfg)
+	if em == nil {
+		t.Fatal("expected the missing socket kept for dialing later")
+	}
+	defer em.Close()
+
+	for restart := 0; restart < 2; restart++ {
+		server, err := Listen("unix:" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := server.WaitLwesMode(1)
+
+		lwe := NewLwesEvent("Test::Event")
+		lwe.Set("restart", int64(restart))
+		if err := em.Emit(lwe); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-out:
+			if got.Attrs["restart"] != int64(restart) {
+				t.Fatalf("unexpected event %v", got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the event received after %d restarts", restart)
+		}
+		server.Stop()
+	}
+}
+
+func TestUnixgramInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lwes.sock")
+	server, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	if _, err := Listen("unix:" + path); err == nil {
+		t.Fatal("expected the socket of a running listener in use")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the socket of the running listener kept, got %v", err)
+	}
+
+	// a stale socket is replaced
+	stale := filepath.Join(t.TempDir(), "stale.sock")
+	c, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: stale, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	s, err := Listen("unix:" + stale)
+	if err != nil {
+		t.Fatalf("expected the stale socket replaced, got %v", err)
+	}
+	s.Stop()
+}